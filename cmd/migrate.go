@@ -1,24 +1,37 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
 	"os"
-	"path/filepath"
-	"sort"
-	"strings"
+	"strconv"
+	"test-go/internal/customer"
+	"test-go/internal/seed"
+	"test-go/internal/webhook"
+	"test-go/migrations"
+	"test-go/pkg/config"
+	database "test-go/pkg/db"
+	"test-go/pkg/migrate"
+	"test-go/pkg/outbox"
+	"time"
 
-	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
 )
 
-var migrationsDir = "../migrations"
-
-func checkAndCreateDB(dbUser, dbPass, dbHost, dbPort, dbName string) error {
-	adminDSN := fmt.Sprintf("postgres://%s:%s@%s:%s/postgres?sslmode=disable", dbUser, dbPass, dbHost, dbPort)
-	adminDB, err := sql.Open("postgres", adminDSN)
+func checkAndCreateDB(cfg config.DatabaseConfig) error {
+	dbName := cfg.Name
+	adminCfg := cfg
+	adminCfg.Name = "postgres"
+	adminDB, err := sql.Open("postgres", adminCfg.DSN())
 	if err != nil {
 		return fmt.Errorf("failed to connect to admin DB: %w", err)
 	}
@@ -48,9 +61,8 @@ func checkAndCreateDB(dbUser, dbPass, dbHost, dbPort, dbName string) error {
 	return nil
 }
 
-func connectAppDB(dbUser, dbPass, dbHost, dbPort, dbName string) (*sql.DB, error) {
-	appDSN := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", dbUser, dbPass, dbHost, dbPort, dbName)
-	appDB, err := sql.Open("postgres", appDSN)
+func connectAppDB(cfg config.DatabaseConfig) (*sql.DB, error) {
+	appDB, err := sql.Open("postgres", cfg.DSN())
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to app DB: %w", err)
 	}
@@ -61,114 +73,361 @@ func connectAppDB(dbUser, dbPass, dbHost, dbPort, dbName string) (*sql.DB, error
 	return appDB, nil
 }
 
-func runMigration(dbUser, dbPass, dbHost, dbPort, dbName string) error {
-	appDB, err := connectAppDB(dbUser, dbPass, dbHost, dbPort, dbName)
+var seedsDir = "../seeds"
+
+// models lists the gorm models whose tables are checked by "verify".
+var models = []interface{}{
+	&customer.Customer{},
+	&customer.CustomerAudit{},
+	&customer.CustomerVersion{},
+	&outbox.Event{},
+	&webhook.Webhook{},
+	&webhook.Delivery{},
+}
+
+func newRunner(appDB *sql.DB) (*migrate.Runner, error) {
+	all, err := migrate.Load(migrations.FS)
+	if err != nil {
+		return nil, err
+	}
+	return migrate.NewRunner(appDB, all), nil
+}
+
+func runMigration(cfg config.DatabaseConfig) error {
+	appDB, err := connectAppDB(cfg)
 	if err != nil {
 		return err
 	}
 	defer appDB.Close()
 
-	files, err := ioutil.ReadDir(migrationsDir)
+	runner, err := newRunner(appDB)
 	if err != nil {
-		return fmt.Errorf("failed to read migrations directory: %w", err)
+		return err
+	}
+	if err := runner.Up(); err != nil {
+		return err
 	}
 
-	var sqlFiles []string
-	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), ".up.sql") {
-			sqlFiles = append(sqlFiles, filepath.Join(migrationsDir, file.Name()))
+	fmt.Println("All migrations ran successfully.")
+	return nil
+}
+
+// rollbackMigration rolls back the last migration, or every migration when all
+// is set.
+func rollbackMigration(cfg config.DatabaseConfig, all bool) error {
+	appDB, err := connectAppDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer appDB.Close()
+
+	runner, err := newRunner(appDB)
+	if err != nil {
+		return err
+	}
+	rollBack := runner.Down
+	if all {
+		rollBack = runner.DownAll
+	}
+	if err := rollBack(); err != nil {
+		return err
+	}
+
+	fmt.Println("Rollback completed successfully.")
+	return nil
+}
+
+// verifySchema prints the drift between the registered models and the
+// database and reports whether they match.
+func verifySchema(cfg config.DatabaseConfig) (bool, error) {
+	appDB, err := connectAppDB(cfg)
+	if err != nil {
+		return false, err
+	}
+	defer appDB.Close()
+
+	diffs, err := migrate.Verify(appDB, models...)
+	if err != nil {
+		return false, err
+	}
+
+	if len(diffs) == 0 {
+		fmt.Println("Schema matches the models.")
+		return true, nil
+	}
+
+	fmt.Println("Schema drift detected:")
+	for _, diff := range diffs {
+		fmt.Println("  -", diff)
+	}
+	return false, nil
+}
+
+// seedDatabase loads the base fixtures and those of env from seedsDir.
+func seedDatabase(cfg *config.Config, env string) error {
+	db, err := database.ConnectPostgres(cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to app DB: %w", err)
+	}
+
+	repo := customer.NewRepository(db)
+	seeder := seed.New()
+	seeder.Register("customers", seed.CustomerLoader(context.Background(), customer.NewService(repo, customer.NewUnitOfWork(db, customer.NewRepository))))
+
+	if err := seeder.Run(os.DirFS(seedsDir), env); err != nil {
+		return err
+	}
+
+	fmt.Println("Seeding completed successfully.")
+	return nil
+}
+
+// generateCustomers inserts synthetic customers in batches using COPY.
+func generateCustomers(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	count := flags.Int("n", 1000, "number of customers to generate")
+	seedValue := flags.Int64("seed", 1, "random seed, the same seed generates the same customers")
+	batchSize := flags.Int("batch", 1000, "customers per COPY batch")
+	days := flags.Int("days", 365, "spread created_at over this many days before now")
+	flags.Parse(args)
+
+	if *count < 1 || *batchSize < 1 || *days < 1 {
+		return fmt.Errorf("n, batch and days must be positive")
+	}
+
+	db, err := database.ConnectPostgres(cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to app DB: %w", err)
+	}
+
+	repo := customer.NewRepository(db)
+	to := time.Now()
+	generator := customer.NewGenerator(*seedValue, to.AddDate(0, 0, -*days), to)
+
+	var total int64
+	for remaining := *count; remaining > 0; remaining -= *batchSize {
+		copied, err := repo.BulkCreate(context.Background(), generator.Batch(min(*batchSize, remaining)))
+		if err != nil {
+			return fmt.Errorf("failed to insert generated customers: %w", err)
 		}
+		total += copied
+		fmt.Printf("Inserted %d/%d customers\n", total, *count)
 	}
-	sort.Strings(sqlFiles)
 
-	for _, file := range sqlFiles {
-		fmt.Println("Running migration:", file)
-		sqlBytes, err := ioutil.ReadFile(file)
+	fmt.Println("Generation completed successfully.")
+	return nil
+}
+
+// exportCustomers streams every customer, pseudonymized with ANONYMIZE_KEY,
+// to a JSON lines file or straight into another database.
+func exportCustomers(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	out := flags.String("out", "", "write the customers to this JSON lines file")
+	targetDSN := flags.String("target-dsn", "", "copy the customers into the database at this DSN")
+	batchSize := flags.Int("batch", 1000, "customers read per batch")
+	flags.Parse(args)
+
+	if (*out == "") == (*targetDSN == "") {
+		return errors.New("exactly one of -out or -target-dsn is required")
+	}
+	key := cfg.Export.AnonymizeKey
+	if key == "" {
+		return errors.New("ANONYMIZE_KEY is not set")
+	}
+
+	db, err := database.ConnectPostgres(cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to app DB: %w", err)
+	}
+
+	var write func(batch []customer.Customer) error
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		writer := bufio.NewWriter(file)
+		defer writer.Flush()
+
+		encoder := json.NewEncoder(writer)
+		write = func(batch []customer.Customer) error {
+			for _, c := range batch {
+				if err := encoder.Encode(c); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	} else {
+		targetDB, err := gorm.Open(postgres.Open(*targetDSN), &gorm.Config{})
 		if err != nil {
-			return fmt.Errorf("failed to read file %s: %w", file, err)
+			return fmt.Errorf("failed to connect to target DB: %w", err)
 		}
-		if _, err := appDB.Exec(string(sqlBytes)); err != nil {
-			return fmt.Errorf("failed to execute migration %s: %w", file, err)
+		target := customer.NewRepository(targetDB)
+		write = func(batch []customer.Customer) error {
+			_, err := target.BulkCreate(context.Background(), batch)
+			return err
 		}
 	}
 
-	fmt.Println("All migrations ran successfully.")
+	anonymizer := customer.NewAnonymizer([]byte(key))
+	total := 0
+	err = customer.NewRepository(db).FindInBatches(context.Background(), *batchSize, func(batch []customer.Customer) error {
+		anonymized := make([]customer.Customer, len(batch))
+		for i, c := range batch {
+			anonymized[i] = anonymizer.Customer(c)
+		}
+		total += len(batch)
+		return write(anonymized)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to export customers: %w", err)
+	}
+
+	fmt.Printf("Exported %d customers.\n", total)
 	return nil
 }
 
-func rollbackMigration(dbUser, dbPass, dbHost, dbPort, dbName string) error {
-	appDB, err := connectAppDB(dbUser, dbPass, dbHost, dbPort, dbName)
+// importCustomers loads a file written by exportCustomers, keeping ids and timestamps.
+func importCustomers(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	in := flags.String("in", "", "JSON lines file written by export")
+	batchSize := flags.Int("batch", 1000, "customers per COPY batch")
+	flags.Parse(args)
+
+	if *in == "" {
+		return errors.New("-in is required")
+	}
+
+	file, err := os.Open(*in)
 	if err != nil {
 		return err
 	}
-	defer appDB.Close()
+	defer file.Close()
 
-	files, err := ioutil.ReadDir(migrationsDir)
+	db, err := database.ConnectPostgres(cfg.Database)
 	if err != nil {
-		return fmt.Errorf("failed to read migrations directory: %w", err)
+		return fmt.Errorf("failed to connect to app DB: %w", err)
 	}
+	repo := customer.NewRepository(db)
 
-	var sqlFiles []string
-	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), ".down.sql") {
-			sqlFiles = append(sqlFiles, filepath.Join(migrationsDir, file.Name()))
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	batch := make([]customer.Customer, 0, *batchSize)
+	var total int64
+	for {
+		var c customer.Customer
+		err := decoder.Decode(&c)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read %s: %w", *in, err)
+		}
+		if err == nil {
+			batch = append(batch, c)
 		}
-	}
-
-	// Rollback ต้อง reverse order
-	sort.Sort(sort.Reverse(sort.StringSlice(sqlFiles)))
 
-	for _, file := range sqlFiles {
-		fmt.Println("Rolling back:", file)
-		sqlBytes, err := ioutil.ReadFile(file)
-		if err != nil {
-			return fmt.Errorf("failed to read file %s: %w", file, err)
+		if len(batch) == *batchSize || (errors.Is(err, io.EOF) && len(batch) > 0) {
+			copied, err := repo.BulkCreate(context.Background(), batch)
+			if err != nil {
+				return fmt.Errorf("failed to import customers: %w", err)
+			}
+			total += copied
+			batch = batch[:0]
 		}
-		if _, err := appDB.Exec(string(sqlBytes)); err != nil {
-			return fmt.Errorf("failed to execute rollback %s: %w", file, err)
+
+		if errors.Is(err, io.EOF) {
+			break
 		}
 	}
 
-	fmt.Println("Rollback completed successfully.")
+	fmt.Printf("Imported %d customers.\n", total)
 	return nil
 }
 
-func main() {
-	if err := godotenv.Load("../.env"); err != nil {
-		log.Fatal("Error loading .env file:", err)
+// requeueOutbox makes the parked outbox events listed in args, or every parked
+// event when there are none, publishable again.
+func requeueOutbox(cfg *config.Config, args []string) error {
+	ids := make([]uint64, 0, len(args))
+	for _, arg := range args {
+		id, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid outbox event id %q", arg)
+		}
+		ids = append(ids, id)
 	}
 
-	dbUser := os.Getenv("DB_USER")
-	dbPass := os.Getenv("DB_PASSWORD")
-	dbHost := os.Getenv("DB_HOST")
-	dbPort := os.Getenv("DB_PORT")
-	dbName := os.Getenv("DB_NAME")
+	db, err := database.ConnectPostgres(cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to app DB: %w", err)
+	}
 
-	if dbUser == "" || dbPass == "" || dbHost == "" || dbPort == "" || dbName == "" {
-		log.Fatal("Database environment variables are not set properly")
+	requeued, err := outbox.Requeue(context.Background(), db, ids...)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Requeued %d outbox events.\n", requeued)
+	return nil
+}
+
+func main() {
+	cfg, err := config.Load(nil, "../.env")
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	if err := checkAndCreateDB(dbUser, dbPass, dbHost, dbPort, dbName); err != nil {
+	if err := checkAndCreateDB(cfg.Database); err != nil {
 		log.Fatal(err)
 	}
 
 	// รับ argument เช่น "up" หรือ "down"
 	if len(os.Args) < 2 {
-		log.Fatal("Missing action. Use: go run main.go up OR down")
+		log.Fatal("Missing action. Use: go run migrate.go up, down [all], verify, seed, generate, export, import OR requeue-outbox [id...]")
 	}
 
 	action := os.Args[1]
 
 	switch action {
 	case "up":
-		if err := runMigration(dbUser, dbPass, dbHost, dbPort, dbName); err != nil {
+		if err := runMigration(cfg.Database); err != nil {
 			log.Fatal(err)
 		}
 	case "down":
-		if err := rollbackMigration(dbUser, dbPass, dbHost, dbPort, dbName); err != nil {
+		if err := rollbackMigration(cfg.Database, len(os.Args) > 2 && os.Args[2] == "all"); err != nil {
+			log.Fatal(err)
+		}
+	case "verify":
+		ok, err := verifySchema(cfg.Database)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+	case "seed":
+		env := cfg.Env
+		if len(os.Args) > 2 {
+			env = os.Args[2]
+		}
+		if err := seedDatabase(cfg, env); err != nil {
+			log.Fatal(err)
+		}
+	case "generate":
+		if err := generateCustomers(cfg, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+	case "export":
+		if err := exportCustomers(cfg, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+	case "import":
+		if err := importCustomers(cfg, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+	case "requeue-outbox":
+		if err := requeueOutbox(cfg, os.Args[2:]); err != nil {
 			log.Fatal(err)
 		}
 	default:
-		log.Fatalf("Unknown action: %s. Use: up or down", action)
+		log.Fatalf("Unknown action: %s. Use: up, down [all], verify, seed, generate, export, import or requeue-outbox [id...]", action)
 	}
 }
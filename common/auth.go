@@ -0,0 +1,37 @@
+package common
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+)
+
+const principalKey = "principal"
+
+type principalContextKey struct{}
+
+// MockAuth authenticates every request as user until token decoding is in place.
+func MockAuth(user string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(principalKey, user)
+		c.Request = c.Request.WithContext(WithPrincipal(c.Request.Context(), user))
+		c.Next()
+	}
+}
+
+// Principal returns the user the request is authenticated as.
+func Principal(c *gin.Context) string {
+	return c.GetString(principalKey)
+}
+
+// WithPrincipal returns a copy of ctx acting as user, for the layers below the
+// handlers and for work started outside a request.
+func WithPrincipal(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, user)
+}
+
+// PrincipalFromContext returns the user ctx acts as, or "" when there is none.
+func PrincipalFromContext(ctx context.Context) string {
+	user, _ := ctx.Value(principalContextKey{}).(string)
+	return user
+}
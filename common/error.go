@@ -1,11 +1,39 @@
 package common
 
-import "github.com/gin-gonic/gin"
+import (
+	"net/http"
+	"test-go/pkg/logging"
+
+	"github.com/gin-gonic/gin"
+)
 
 type ResponseError struct {
-	Error string `json:"error" example:"error message"`
+	Error     string `json:"error" example:"error message"`
+	RequestID string `json:"requestId,omitempty" example:"4f1c2b7e9a0d4c3b8e6f5a4d3c2b1a09"`
 }
 
 func JSONError(c *gin.Context, status int, errMsg string) {
 	c.JSON(status, ResponseError{Error: errMsg})
 }
+
+// InternalError logs err with its full detail on the server and answers with
+// a generic message, so database errors and personal data never reach the
+// client. The request id lets support find the log line. Errors caused by the
+// request context ending answer 504 or 503 instead of 500.
+func InternalError(c *gin.Context, err error) {
+	if status, ok := contextError(c, err); ok {
+		logging.FromContext(c.Request.Context()).Warn("request context ended", "error", err, "status", status)
+		c.JSON(status, ResponseError{
+			Error:     http.StatusText(status),
+			RequestID: GetRequestID(c),
+		})
+		return
+	}
+
+	logging.FromContext(c.Request.Context()).Error("internal server error", "error", err)
+
+	c.JSON(http.StatusInternalServerError, ResponseError{
+		Error:     http.StatusText(http.StatusInternalServerError),
+		RequestID: GetRequestID(c),
+	})
+}
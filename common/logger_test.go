@@ -0,0 +1,92 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"test-go/pkg/logging"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newLoggedRouter(buf *bytes.Buffer) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestID(logging.New(buf, "debug")), AccessLog(), MockAuth("unit@test.com"))
+	r.GET("/customers/:id", func(c *gin.Context) {
+		logging.FromContext(c.Request.Context()).Info("handler")
+		c.Status(http.StatusNoContent)
+	})
+	return r
+}
+
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var lines []map[string]interface{}
+	decoder := json.NewDecoder(buf)
+	for decoder.More() {
+		var line map[string]interface{}
+		assert.NoError(t, decoder.Decode(&line))
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestRequestID_AcceptsIncomingID(t *testing.T) {
+	var buf bytes.Buffer
+	router := newLoggedRouter(&buf)
+
+	req := httptest.NewRequest(http.MethodGet, "/customers/1", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	assert.Equal(t, "abc-123", recorder.Header().Get(RequestIDHeader))
+
+	lines := decodeLines(t, &buf)
+	assert.Len(t, lines, 2)
+	assert.Equal(t, "abc-123", lines[0]["request_id"])
+
+	access := lines[1]
+	assert.Equal(t, "request", access["msg"])
+	assert.Equal(t, "abc-123", access["request_id"])
+	assert.Equal(t, "GET", access["method"])
+	assert.Equal(t, "/customers/:id", access["route"])
+	assert.Equal(t, float64(http.StatusNoContent), access["status"])
+	assert.Equal(t, "unit@test.com", access["principal"])
+	assert.Contains(t, access, "latency_ms")
+}
+
+func TestRequestID_GeneratesIDForMissingOrInvalidHeader(t *testing.T) {
+	var buf bytes.Buffer
+	router := newLoggedRouter(&buf)
+
+	req := httptest.NewRequest(http.MethodGet, "/customers/1", nil)
+	req.Header.Set(RequestIDHeader, "not valid\nid")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	generated := recorder.Header().Get(RequestIDHeader)
+	assert.Len(t, generated, 32)
+	assert.Equal(t, generated, decodeLines(t, &buf)[0]["request_id"])
+}
+
+func TestRequestIDAndPrincipal_AreInRequestContext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestID(logging.New(io.Discard, "info")), MockAuth("unit@test.com"))
+	r.GET("/", func(c *gin.Context) {
+		assert.Equal(t, "abc-123", RequestIDFromContext(c.Request.Context()))
+		assert.Equal(t, "unit@test.com", PrincipalFromContext(c.Request.Context()))
+		c.Status(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+}
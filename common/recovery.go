@@ -2,19 +2,24 @@ package common
 
 import (
 	"fmt"
+	"io"
 	"net/http"
 	"runtime/debug"
+	"test-go/pkg/logging"
 
 	"github.com/gin-gonic/gin"
 )
 
 func JSONRecovery() gin.HandlerFunc {
-	return gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
-		fmt.Printf("Panic recovered: %v\n", recovered)
-		debug.PrintStack()
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered interface{}) {
+		logging.FromContext(c.Request.Context()).Error("panic recovered",
+			"panic", fmt.Sprint(recovered),
+			"stack", string(debug.Stack()),
+		)
 
 		c.JSON(http.StatusInternalServerError, ResponseError{
-			Error: fmt.Sprintf("Internal Server Error: %v", recovered),
+			Error:     http.StatusText(http.StatusInternalServerError),
+			RequestID: GetRequestID(c),
 		})
 		c.Abort()
 	})
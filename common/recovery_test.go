@@ -0,0 +1,45 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"test-go/pkg/logging"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFiveHundredsHideDetailFromClient(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	r := gin.New()
+	r.Use(RequestID(logging.New(&buf, "info")), JSONRecovery())
+	r.GET("/panic", func(c *gin.Context) {
+		panic("customer somchai@example.com is broken")
+	})
+	r.GET("/error", func(c *gin.Context) {
+		InternalError(c, errors.New(`pq: duplicate key value "somchai@example.com"`))
+	})
+
+	for _, path := range []string{"/panic", "/error"} {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(RequestIDHeader, "incident-1")
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+
+		var response ResponseError
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		assert.Equal(t, ResponseError{Error: "Internal Server Error", RequestID: "incident-1"}, response)
+
+		assert.Contains(t, buf.String(), "s****@example.com")
+		assert.Contains(t, buf.String(), `"request_id":"incident-1"`)
+		assert.NotContains(t, buf.String(), "somchai@")
+	}
+}
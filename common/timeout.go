@@ -0,0 +1,90 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"test-go/pkg/logging"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Timeout gives the handlers after it d to answer. Their request context
+// expires after d, which cancels the database queries still running. A
+// handler that has not answered by then, because it ignored the context or
+// answers too late, gets its response dropped and the request answers 504.
+// Nested timeouts only ever shorten the deadline.
+func Timeout(d time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), d)
+		defer cancel()
+
+		writer := &timeoutWriter{ResponseWriter: c.Writer, ctx: ctx}
+		c.Request = c.Request.WithContext(ctx)
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if writer.expired() && !c.Writer.Written() {
+			logging.FromContext(ctx).Warn("request timed out", "timeout", d.String())
+			c.AbortWithStatusJSON(http.StatusGatewayTimeout, ResponseError{
+				Error:     http.StatusText(http.StatusGatewayTimeout),
+				RequestID: GetRequestID(c),
+			})
+		}
+	}
+}
+
+// timeoutWriter drops the response of a handler that starts answering after
+// the deadline of ctx.
+type timeoutWriter struct {
+	gin.ResponseWriter
+	ctx context.Context
+}
+
+// expired reports whether the deadline passed before the handler answered.
+func (w *timeoutWriter) expired() bool {
+	return !w.ResponseWriter.Written() && errors.Is(w.ctx.Err(), context.DeadlineExceeded)
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	if !w.expired() {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	if !w.expired() {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	if w.expired() {
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	if w.expired() {
+		return len(s), nil
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// contextError reports whether err comes from the request context ending, and
+// the status that describes it: 504 when the deadline expired and 503 when the
+// request was canceled, because the client went away or the server is
+// shutting down.
+func contextError(c *gin.Context, err error) (int, bool) {
+	ctxErr := c.Request.Context().Err()
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctxErr, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, true
+	case errors.Is(err, context.Canceled) || errors.Is(ctxErr, context.Canceled):
+		return http.StatusServiceUnavailable, true
+	}
+	return 0, false
+}
@@ -0,0 +1,78 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeout_AnswersGatewayTimeoutWhenDeadlineExpires(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/slow", Timeout(10*time.Millisecond), func(c *gin.Context) {
+		// stands in for a query canceled by the deadline
+		<-c.Request.Context().Done()
+		InternalError(c, errors.New("timeout: context already done"))
+	})
+	r.GET("/fast", Timeout(time.Second), func(c *gin.Context) {
+		_, ok := c.Request.Context().Deadline()
+		assert.True(t, ok)
+		c.Status(http.StatusNoContent)
+	})
+
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	assert.Equal(t, http.StatusGatewayTimeout, recorder.Code)
+
+	var response ResponseError
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, "Gateway Timeout", response.Error)
+
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+}
+
+func TestTimeout_AnswersGatewayTimeoutForHandlersIgnoringTheDeadline(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestID(slog.New(slog.DiscardHandler)))
+	r.GET("/blocking", Timeout(10*time.Millisecond), func(c *gin.Context) {
+		time.Sleep(50 * time.Millisecond)
+		c.JSON(http.StatusOK, gin.H{"late": true})
+	})
+	r.GET("/silent", Timeout(10*time.Millisecond), func(c *gin.Context) {
+		<-c.Request.Context().Done()
+	})
+
+	for _, path := range []string{"/blocking", "/silent"} {
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusGatewayTimeout, recorder.Code, path)
+
+		var response ResponseError
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response), path)
+		assert.Equal(t, "Gateway Timeout", response.Error)
+		assert.NotEmpty(t, response.RequestID)
+	}
+}
+
+func TestInternalError_AnswersServiceUnavailableWhenCanceled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/canceled", func(c *gin.Context) {
+		InternalError(c, context.Canceled)
+	})
+
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/canceled", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+}
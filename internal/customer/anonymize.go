@@ -0,0 +1,60 @@
+package customer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+)
+
+const anonymizedEmailDomain = "example.invalid"
+
+// Anonymizer replaces the personal data of customers with pseudonyms derived
+// from a keyed HMAC. The same key always maps a value to the same pseudonym,
+// so emails stay unique and consistent across tables and exports, while the
+// original value cannot be recovered without the key.
+type Anonymizer struct {
+	key []byte
+}
+
+func NewAnonymizer(key []byte) *Anonymizer {
+	return &Anonymizer{key: key}
+}
+
+// Customer returns a copy of customer with name_th, name_en, email and the
+// emails of the staff who created and last updated it pseudonymized. Ids,
+// flags and timestamps are kept as they are.
+func (a *Anonymizer) Customer(customer Customer) Customer {
+	// both names are derived from the same digest so they stay translations of each other
+	nameDigest := a.digest("name", customer.NameTh+"\x00"+customer.NameEn)
+	first := generatorFirstNames[pick(nameDigest[0:8], len(generatorFirstNames))]
+	last := generatorLastNames[pick(nameDigest[8:16], len(generatorLastNames))]
+
+	customer.NameTh = first.Th + " " + last.Th
+	customer.NameEn = first.En + " " + last.En
+	customer.Email = "user-" + hex.EncodeToString(a.digest("email", NormalizeEmail(customer.Email))[:10]) + "@" + anonymizedEmailDomain
+	customer.CreatedBy = a.actor(customer.CreatedBy)
+	customer.UpdatedBy = a.actor(customer.UpdatedBy)
+	return customer
+}
+
+// actor pseudonymizes the staff member recorded as making a change, keeping
+// the same staff member the same pseudonym across customers.
+func (a *Anonymizer) actor(actor string) string {
+	if actor == "" {
+		return ""
+	}
+	return "staff-" + hex.EncodeToString(a.digest("actor", NormalizeEmail(actor))[:10]) + "@" + anonymizedEmailDomain
+}
+
+func (a *Anonymizer) digest(field, value string) []byte {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(field))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+func pick(b []byte, n int) int {
+	return int(binary.BigEndian.Uint64(b) % uint64(n))
+}
@@ -0,0 +1,53 @@
+package customer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnonymizer_Customer(t *testing.T) {
+	createdAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	original := Customer{
+		Id:        7,
+		NameTh:    "สมชาย ใจดี",
+		NameEn:    "Somchai Jaidee",
+		Email:     "somchai@example.com",
+		IsDeleted: true,
+		CreatedBy: "admin@example.com",
+		CreatedAt: createdAt,
+		UpdatedBy: "Admin@Example.com",
+		UpdatedAt: createdAt.Add(time.Hour),
+	}
+
+	anonymized := NewAnonymizer([]byte("key-1")).Customer(original)
+
+	assert.NotEqual(t, original.NameTh, anonymized.NameTh)
+	assert.NotEqual(t, original.NameEn, anonymized.NameEn)
+	assert.NotContains(t, anonymized.Email, "somchai")
+	assert.True(t, strings.HasSuffix(anonymized.Email, "@example.invalid"))
+	assert.NotContains(t, anonymized.CreatedBy, "admin")
+	assert.True(t, strings.HasSuffix(anonymized.CreatedBy, "@example.invalid"))
+	assert.Equal(t, anonymized.CreatedBy, anonymized.UpdatedBy, "the same staff member keeps the same pseudonym")
+	assert.Empty(t, NewAnonymizer([]byte("key-1")).Customer(Customer{}).UpdatedBy)
+	assert.NoError(t, normalizeAndValidate(&CustomerCreateBody{NameTh: anonymized.NameTh, NameEn: anonymized.NameEn, Email: anonymized.Email}))
+
+	assert.Equal(t, original.Id, anonymized.Id)
+	assert.Equal(t, original.IsDeleted, anonymized.IsDeleted)
+	assert.Equal(t, original.CreatedAt, anonymized.CreatedAt)
+	assert.Equal(t, original.UpdatedAt, anonymized.UpdatedAt)
+}
+
+func TestAnonymizer_IsDeterministicPerKey(t *testing.T) {
+	c := Customer{NameTh: "สมชาย ใจดี", NameEn: "Somchai Jaidee", Email: "somchai@example.com"}
+	sameEmail := Customer{NameTh: "อื่น", NameEn: "Other", Email: " Somchai@Example.com "}
+
+	a := NewAnonymizer([]byte("key-1"))
+	assert.Equal(t, a.Customer(c), a.Customer(c))
+	assert.Equal(t, a.Customer(c).Email, a.Customer(sameEmail).Email)
+
+	b := NewAnonymizer([]byte("key-2"))
+	assert.NotEqual(t, a.Customer(c).Email, b.Customer(c).Email)
+}
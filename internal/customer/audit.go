@@ -0,0 +1,87 @@
+package customer
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"test-go/common"
+	"test-go/pkg/outbox"
+)
+
+// AuditChange is the value of one field before and after a change. Before is
+// null for a create and After is null for a purge.
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// auditedFields returns the fields of c whose changes are audited, keyed like
+// the JSON of Customer.
+func auditedFields(c *Customer) map[string]interface{} {
+	if c == nil {
+		return map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"name_th":    c.NameTh,
+		"name_en":    c.NameEn,
+		"email":      c.Email,
+		"is_deleted": c.IsDeleted,
+	}
+}
+
+// diffCustomers lists the audited fields that differ between before and
+// after, either of which may be nil.
+func diffCustomers(before, after *Customer) map[string]AuditChange {
+	beforeFields, afterFields := auditedFields(before), auditedFields(after)
+
+	changes := map[string]AuditChange{}
+	for _, fields := range []map[string]interface{}{beforeFields, afterFields} {
+		for name := range fields {
+			if beforeFields[name] != afterFields[name] {
+				changes[name] = AuditChange{Before: beforeFields[name], After: afterFields[name]}
+			}
+		}
+	}
+	return changes
+}
+
+// recordChange writes the audit record, the new version and the outbox event
+// of a change, and notifies the replicas of it, with repo, which must be the
+// repository of the transaction making the change. After is nil for a purge.
+// The request id comes from ctx.
+func recordChange(ctx context.Context, repo Repository, action, actor string, customerId uint, before, after *Customer) error {
+	if err := repo.RecordVersion(ctx, customerId, after); err != nil {
+		return err
+	}
+
+	if err := repo.NotifyChanged(ctx, customerId); err != nil {
+		return err
+	}
+
+	requestId := common.RequestIDFromContext(ctx)
+	changes, err := json.Marshal(diffCustomers(before, after))
+	if err != nil {
+		return err
+	}
+	err = repo.CreateAudit(ctx, &CustomerAudit{
+		CustomerId: customerId,
+		Action:     action,
+		Actor:      actor,
+		RequestId:  requestId,
+		Changes:    changes,
+	})
+	if err != nil {
+		return err
+	}
+
+	event, err := outbox.NewEvent(eventTypes[action], strconv.FormatUint(uint64(customerId), 10), CustomerEvent{
+		CustomerId: customerId,
+		Customer:   after,
+		Actor:      actor,
+		RequestId:  requestId,
+	})
+	if err != nil {
+		return err
+	}
+	return repo.RecordEvent(ctx, event)
+}
@@ -0,0 +1,293 @@
+package customer
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"strconv"
+	"sync/atomic"
+	"test-go/pkg/cache"
+	database "test-go/pkg/db"
+	"test-go/pkg/logging"
+	"test-go/pkg/metrics"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// RepositoryCache caches the customers read by id and by email for the
+// repositories it wraps, which share its entries. Misses are cached too, for
+// negativeTTL, and concurrent misses of the same entry run a single query.
+type RepositoryCache struct {
+	cache       cache.Cache
+	ttl         time.Duration
+	negativeTTL time.Duration
+	loads       singleflight.Group
+	// generation changes whenever anything is invalidated, so that a load
+	// racing an invalidation does not cache what it read before it.
+	generation atomic.Uint64
+}
+
+func NewRepositoryCache(backend cache.Cache, ttl, negativeTTL time.Duration) *RepositoryCache {
+	rc := &RepositoryCache{cache: backend, ttl: ttl, negativeTTL: negativeTTL}
+	// Cached email misses are tagged with the generation, which must not
+	// match the generations of the other replicas sharing an external cache.
+	rc.generation.Store(rand.Uint64())
+	return rc
+}
+
+// Wrap returns repo reading customers through the cache and invalidating them
+// when it writes.
+func (rc *RepositoryCache) Wrap(repo Repository) Repository {
+	return &cachedRepository{Repository: repo, cache: rc}
+}
+
+// WrapTx returns repo, which belongs to a transaction, invalidating customers
+// when it writes. Its reads bypass the cache, so they see the writes of the
+// transaction and take its locks. Since it invalidates before the transaction
+// commits, a concurrent read may cache the customer as it was; the change
+// notification received after the commit invalidates it again.
+func (rc *RepositoryCache) WrapTx(repo Repository) Repository {
+	return &cachedRepository{Repository: repo, cache: rc, inTx: true}
+}
+
+// Invalidate drops the cached customer id.
+func (rc *RepositoryCache) Invalidate(ctx context.Context, id uint) {
+	rc.invalidate(ctx, idKey(id))
+}
+
+// InvalidateAll drops every cached customer.
+func (rc *RepositoryCache) InvalidateAll(ctx context.Context) {
+	rc.generation.Add(1)
+	if err := rc.cache.Clear(ctx); err != nil {
+		logging.FromContext(ctx).WarnContext(ctx, "failed to clear customer cache", "error", err)
+	}
+}
+
+func (rc *RepositoryCache) invalidate(ctx context.Context, keys ...string) {
+	rc.generation.Add(1)
+	for _, key := range keys {
+		rc.loads.Forget(key)
+	}
+	if err := rc.cache.Delete(ctx, keys...); err != nil {
+		logging.FromContext(ctx).WarnContext(ctx, "failed to invalidate customer cache", "keys", keys, "error", err)
+	}
+}
+
+// lookup decodes the entry of key into value, and reports whether there was
+// one. Failures of the cache count as misses.
+func (rc *RepositoryCache) lookup(ctx context.Context, name, key string, value interface{}) bool {
+	data, ok, err := rc.cache.Get(ctx, key)
+	if err != nil {
+		metrics.CacheLookups.WithLabelValues(name, "error").Inc()
+		logging.FromContext(ctx).WarnContext(ctx, "failed to read customer cache", "key", key, "error", err)
+		return false
+	}
+	if ok {
+		if err := json.Unmarshal(data, value); err == nil {
+			return true
+		}
+		logging.FromContext(ctx).WarnContext(ctx, "ignored invalid customer cache entry", "key", key)
+	}
+	return false
+}
+
+// loadTimeout bounds a shared load, which no longer ends with the request
+// starting it.
+const loadTimeout = 10 * time.Second
+
+// load runs fn once for the concurrent callers of key, passing it the
+// generation current before it started. It reads from the primary, since a
+// replica may not have replayed a change yet when its notification
+// invalidates the cache. The load is not cancelled with the caller starting
+// it, since the other callers wait for it too; a cancelled caller stops
+// waiting instead.
+func (rc *RepositoryCache) load(ctx context.Context, key string, fn func(ctx context.Context, generation uint64) (interface{}, error)) (interface{}, error) {
+	generation := rc.generation.Load()
+	loaded := rc.loads.DoChan(key, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), loadTimeout)
+		defer cancel()
+		return fn(database.ReadPrimary(ctx), generation)
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-loaded:
+		return result.Val, result.Err
+	}
+}
+
+// store caches value under key for ttl, unless something was invalidated since
+// generation.
+func (rc *RepositoryCache) store(ctx context.Context, key string, value interface{}, ttl time.Duration, generation uint64) {
+	if rc.generation.Load() != generation {
+		return
+	}
+	data, err := json.Marshal(value)
+	if err == nil {
+		err = rc.cache.Set(ctx, key, data, ttl)
+	}
+	if err != nil {
+		logging.FromContext(ctx).WarnContext(ctx, "failed to write customer cache", "key", key, "error", err)
+	}
+}
+
+func (rc *RepositoryCache) ttlOf(found bool) time.Duration {
+	if found {
+		return rc.ttl
+	}
+	return rc.negativeTTL
+}
+
+func idKey(id uint) string {
+	return "customer:id:" + strconv.FormatUint(uint64(id), 10)
+}
+
+func emailKey(email string) string {
+	return "customer:email:" + email
+}
+
+// emailEntry is the cached id of the customer having an email, nil when none
+// has it. Since a customer taking the email can not be told apart from the
+// others when only its id is notified, a miss is only used by the replica
+// that cached it, until it invalidates anything.
+type emailEntry struct {
+	Id         *uint  `json:"id"`
+	Generation uint64 `json:"generation,omitempty"`
+}
+
+type cachedRepository struct {
+	Repository
+	cache *RepositoryCache
+	inTx  bool
+}
+
+func (r *cachedRepository) FindById(ctx context.Context, id uint) (*Customer, error) {
+	if r.inTx {
+		return r.Repository.FindById(ctx, id)
+	}
+
+	key := idKey(id)
+	var customer *Customer
+	if r.cache.lookup(ctx, "customer_by_id", key, &customer) {
+		metrics.CacheLookups.WithLabelValues("customer_by_id", "hit").Inc()
+		return customer, nil
+	}
+	metrics.CacheLookups.WithLabelValues("customer_by_id", "miss").Inc()
+
+	value, err := r.cache.load(ctx, key, func(ctx context.Context, generation uint64) (interface{}, error) {
+		customer, err := r.Repository.FindById(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		r.cache.store(ctx, key, customer, r.cache.ttlOf(customer != nil), generation)
+		return customer, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// The callers of a shared load get their own copy to change.
+	if customer := value.(*Customer); customer != nil {
+		clone := *customer
+		return &clone, nil
+	}
+	return nil, nil
+}
+
+func (r *cachedRepository) FindByEmail(ctx context.Context, email string, excludeId *uint) (*Customer, error) {
+	if r.inTx {
+		return r.Repository.FindByEmail(ctx, email, excludeId)
+	}
+
+	key := emailKey(email)
+	var entry emailEntry
+	if r.cache.lookup(ctx, "customer_by_email", key, &entry) && (entry.Id != nil || entry.Generation == r.cache.generation.Load()) {
+		metrics.CacheLookups.WithLabelValues("customer_by_email", "hit").Inc()
+	} else {
+		metrics.CacheLookups.WithLabelValues("customer_by_email", "miss").Inc()
+		value, err := r.cache.load(ctx, key, func(ctx context.Context, generation uint64) (interface{}, error) {
+			customer, err := r.Repository.FindByEmail(ctx, email, nil)
+			if err != nil {
+				return nil, err
+			}
+			entry := emailEntry{Generation: generation}
+			if customer != nil {
+				entry.Id = &customer.Id
+				r.cache.store(ctx, idKey(customer.Id), customer, r.cache.ttl, generation)
+			}
+			r.cache.store(ctx, key, entry, r.cache.ttlOf(customer != nil), generation)
+			return entry, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		entry = value.(emailEntry)
+	}
+	if entry.Id == nil {
+		return nil, nil
+	}
+
+	customer, err := r.FindById(ctx, *entry.Id)
+	if err != nil {
+		return nil, err
+	}
+	if customer == nil || customer.Email != email {
+		// The customer changed its email or was deleted since it was cached.
+		r.cache.invalidate(ctx, key)
+		if customer, err = r.Repository.FindByEmail(ctx, email, nil); err != nil {
+			return nil, err
+		}
+	}
+	if customer != nil && excludeId != nil && customer.Id == *excludeId {
+		return nil, nil
+	}
+	return customer, nil
+}
+
+func (r *cachedRepository) Create(ctx context.Context, customer *Customer) error {
+	if err := r.Repository.Create(ctx, customer); err != nil {
+		return err
+	}
+	r.cache.invalidate(ctx, idKey(customer.Id), emailKey(customer.Email))
+	return nil
+}
+
+func (r *cachedRepository) UpdateById(ctx context.Context, customer *Customer) error {
+	if err := r.Repository.UpdateById(ctx, customer); err != nil {
+		return err
+	}
+	r.cache.invalidate(ctx, idKey(customer.Id), emailKey(customer.Email))
+	return nil
+}
+
+func (r *cachedRepository) DeleteById(ctx context.Context, id uint) error {
+	if err := r.Repository.DeleteById(ctx, id); err != nil {
+		return err
+	}
+	r.cache.invalidate(ctx, idKey(id))
+	return nil
+}
+
+func (r *cachedRepository) RestoreById(ctx context.Context, id uint) error {
+	if err := r.Repository.RestoreById(ctx, id); err != nil {
+		return err
+	}
+	r.cache.invalidate(ctx, idKey(id))
+	return nil
+}
+
+func (r *cachedRepository) PurgeById(ctx context.Context, id uint) error {
+	if err := r.Repository.PurgeById(ctx, id); err != nil {
+		return err
+	}
+	r.cache.invalidate(ctx, idKey(id))
+	return nil
+}
+
+func (r *cachedRepository) BulkCreate(ctx context.Context, customers []Customer) (int64, error) {
+	count, err := r.Repository.BulkCreate(ctx, customers)
+	if count > 0 {
+		r.cache.InvalidateAll(ctx)
+	}
+	return count, err
+}
@@ -0,0 +1,226 @@
+package customer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"test-go/pkg/cache"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// storeRepository returns a mock repository over customers, counting the
+// queries reading them.
+func storeRepository(customers map[uint]*Customer, queries *atomic.Int32) *mockRepository {
+	var mu sync.Mutex
+	find := func(match func(c *Customer) bool) *Customer {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, c := range customers {
+			if !c.IsDeleted && match(c) {
+				clone := *c
+				return &clone
+			}
+		}
+		return nil
+	}
+	return &mockRepository{
+		mockFindById: func(ctx context.Context, id uint) (*Customer, error) {
+			queries.Add(1)
+			return find(func(c *Customer) bool { return c.Id == id }), nil
+		},
+		mockFindByEmail: func(ctx context.Context, email string, excludeId *uint) (*Customer, error) {
+			queries.Add(1)
+			return find(func(c *Customer) bool { return c.Email == email && (excludeId == nil || c.Id != *excludeId) }), nil
+		},
+		mockUpdateById: func(ctx context.Context, customer *Customer) error {
+			mu.Lock()
+			defer mu.Unlock()
+			clone := *customer
+			customers[customer.Id] = &clone
+			return nil
+		},
+		mockDeleteById: func(ctx context.Context, id uint) error {
+			mu.Lock()
+			defer mu.Unlock()
+			customers[id].IsDeleted = true
+			return nil
+		},
+		mockRestoreById: func(ctx context.Context, id uint) error {
+			mu.Lock()
+			defer mu.Unlock()
+			customers[id].IsDeleted = false
+			return nil
+		},
+	}
+}
+
+func TestRepositoryCache_CachesCustomersAndMisses(t *testing.T) {
+	ctx := context.Background()
+	var queries atomic.Int32
+	customers := map[uint]*Customer{1: {Id: 1, NameEn: "Ann", Email: "ann@example.com"}}
+	repo := NewRepositoryCache(cache.NewLRU(10), time.Minute, time.Minute).Wrap(storeRepository(customers, &queries))
+
+	for i := 0; i < 3; i++ {
+		customer, err := repo.FindById(ctx, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, "Ann", customer.NameEn)
+
+		customer, err = repo.FindByEmail(ctx, "ann@example.com", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, uint(1), customer.Id)
+
+		missing, err := repo.FindById(ctx, 2)
+		assert.NoError(t, err)
+		assert.Nil(t, missing)
+
+		missing, err = repo.FindByEmail(ctx, "bob@example.com", nil)
+		assert.NoError(t, err)
+		assert.Nil(t, missing)
+	}
+	assert.Equal(t, int32(4), queries.Load(), "one query per id, email, missing id and missing email")
+
+	excludeId := uint(1)
+	customer, err := repo.FindByEmail(ctx, "ann@example.com", &excludeId)
+	assert.NoError(t, err)
+	assert.Nil(t, customer)
+}
+
+func TestRepositoryCache_WritesInvalidate(t *testing.T) {
+	ctx := context.Background()
+	var queries atomic.Int32
+	customers := map[uint]*Customer{1: {Id: 1, NameEn: "Ann", Email: "ann@example.com"}}
+	rc := NewRepositoryCache(cache.NewLRU(10), time.Minute, time.Minute)
+	repo := rc.Wrap(storeRepository(customers, &queries))
+	tx := rc.WrapTx(storeRepository(customers, &queries))
+
+	_, _ = repo.FindById(ctx, 1)
+	_, _ = repo.FindByEmail(ctx, "ann@example.com", nil)
+	missing, _ := repo.FindByEmail(ctx, "ann@example.org", nil)
+	assert.Nil(t, missing)
+
+	assert.NoError(t, tx.UpdateById(ctx, &Customer{Id: 1, NameEn: "Anne", Email: "ann@example.org"}))
+	customer, _ := repo.FindById(ctx, 1)
+	assert.Equal(t, "Anne", customer.NameEn)
+	customer, _ = repo.FindByEmail(ctx, "ann@example.org", nil)
+	assert.Equal(t, uint(1), customer.Id, "the cached miss of the new email is dropped")
+	customer, _ = repo.FindByEmail(ctx, "ann@example.com", nil)
+	assert.Nil(t, customer, "the old email no longer finds the customer")
+
+	assert.NoError(t, tx.DeleteById(ctx, 1))
+	customer, _ = repo.FindByEmail(ctx, "ann@example.org", nil)
+	assert.Nil(t, customer)
+	assert.NoError(t, tx.RestoreById(ctx, 1))
+	customer, _ = repo.FindByEmail(ctx, "ann@example.org", nil)
+	assert.NotNil(t, customer, "the cached miss of the restored email is dropped")
+
+	// Other replicas invalidate on the change notification.
+	customers[1].NameEn = "Annie"
+	rc.Invalidate(ctx, 1)
+	customer, _ = repo.FindById(ctx, 1)
+	assert.Equal(t, "Annie", customer.NameEn)
+}
+
+func TestRepositoryCache_CoalescesConcurrentMisses(t *testing.T) {
+	ctx := context.Background()
+	var queries atomic.Int32
+	release := make(chan struct{})
+	mock := &mockRepository{mockFindById: func(ctx context.Context, id uint) (*Customer, error) {
+		queries.Add(1)
+		<-release
+		return &Customer{Id: id, NameEn: "Ann"}, nil
+	}}
+	repo := NewRepositoryCache(cache.NewLRU(10), time.Minute, time.Minute).Wrap(mock)
+
+	var wg sync.WaitGroup
+	results := make([]*Customer, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = repo.FindById(ctx, 1)
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), queries.Load())
+	for _, customer := range results {
+		assert.Equal(t, "Ann", customer.NameEn)
+	}
+	assert.NotSame(t, results[0], results[1], "callers get their own copy")
+}
+
+func TestRepositoryCache_SharedLoadOutlivesTheCallerStartingIt(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	mock := &mockRepository{mockFindById: func(ctx context.Context, id uint) (*Customer, error) {
+		close(started)
+		<-release
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return &Customer{Id: id, NameEn: "Ann"}, nil
+	}}
+	repo := NewRepositoryCache(cache.NewLRU(10), time.Minute, time.Minute).Wrap(mock)
+
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := repo.FindById(leaderCtx, 1)
+		leaderErr <- err
+	}()
+	<-started
+
+	follower := make(chan *Customer, 1)
+	go func() {
+		customer, err := repo.FindById(context.Background(), 1)
+		assert.NoError(t, err)
+		follower <- customer
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	cancelLeader()
+	close(release)
+	assert.ErrorIs(t, <-leaderErr, context.Canceled)
+	customer := <-follower
+	if assert.NotNil(t, customer) {
+		assert.Equal(t, "Ann", customer.NameEn)
+	}
+}
+
+// failingCache stands in for an unreachable external cache.
+type failingCache struct{}
+
+var errCacheDown = errors.New("cache down")
+
+func (failingCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	return nil, false, errCacheDown
+}
+
+func (failingCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return errCacheDown
+}
+
+func (failingCache) Delete(ctx context.Context, keys ...string) error { return errCacheDown }
+
+func (failingCache) Clear(ctx context.Context) error { return errCacheDown }
+
+func TestRepositoryCache_FallsBackToRepositoryWhenCacheFails(t *testing.T) {
+	ctx := context.Background()
+	var queries atomic.Int32
+	customers := map[uint]*Customer{1: {Id: 1, NameEn: "Ann", Email: "ann@example.com"}}
+	repo := NewRepositoryCache(failingCache{}, time.Minute, time.Minute).Wrap(storeRepository(customers, &queries))
+
+	customer, err := repo.FindById(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "Ann", customer.NameEn)
+	customer, err = repo.FindByEmail(ctx, "ann@example.com", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), customer.Id)
+	assert.NoError(t, repo.UpdateById(ctx, &Customer{Id: 1, NameEn: "Anne", Email: "ann@example.com"}))
+}
@@ -0,0 +1,52 @@
+package customer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerator_IsDeterministic(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(1, 0, 0)
+
+	first := NewGenerator(42, from, to).Batch(50)
+	second := NewGenerator(42, from, to).Batch(50)
+	other := NewGenerator(7, from, to).Batch(50)
+
+	assert.Equal(t, first, second)
+	assert.NotEqual(t, first, other)
+}
+
+func TestGenerator_ProducesValidCustomers(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 6, 0)
+
+	emails := map[string]bool{}
+	for _, c := range NewGenerator(1, from, to).Batch(500) {
+		assert.NoError(t, normalizeAndValidate(&CustomerCreateBody{NameTh: c.NameTh, NameEn: c.NameEn, Email: c.Email}))
+		assert.False(t, emails[c.Email], "duplicate email %s", c.Email)
+		emails[c.Email] = true
+
+		assert.False(t, c.CreatedAt.Before(from))
+		assert.False(t, c.CreatedAt.After(to))
+		assert.False(t, c.UpdatedAt.Before(c.CreatedAt))
+		assert.False(t, c.UpdatedAt.After(to))
+	}
+}
+
+func TestGenerator_SeedsProduceDisjointEmails(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(1, 0, 0)
+
+	emails := map[string]bool{}
+	for _, c := range NewGenerator(1, from, to).Batch(1000) {
+		emails[c.Email] = true
+	}
+	for _, seed := range []int64{2, 11, -1} {
+		for _, c := range NewGenerator(seed, from, to).Batch(1000) {
+			assert.False(t, emails[c.Email], "seed %d repeats email %s", seed, c.Email)
+		}
+	}
+}
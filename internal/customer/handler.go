@@ -1,10 +1,12 @@
 package customer
 
 import (
-	"fmt"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"test-go/common"
+	"test-go/pkg/logging"
 
 	"github.com/gin-gonic/gin"
 )
@@ -29,6 +31,7 @@ func NewHandler(repo Repository, service Service) *Handler {
 // @Param customer body CustomerCreateBody true "Customer Info"
 // @Success 201 {object} map[string]interface{} "Created"
 // @Failure 400 {object} common.ResponseError
+// @Failure 409 {object} common.ResponseError
 // @Failure 500 {object} common.ResponseError
 // @Router /customers/ [post]
 func (h *Handler) Create(c *gin.Context) {
@@ -39,16 +42,24 @@ func (h *Handler) Create(c *gin.Context) {
 		return
 	}
 
-	user := "email@mock.com" // Decode token at middleware
+	user := common.Principal(c)
 
 	input := &CustomerServiceCreateInput{
 		CustomerCreateBody: body,
 		CreatedBy:          user,
 	}
 
-	customerId, err := h.Service.Create(input)
+	customerId, err := h.Service.Create(c.Request.Context(), input)
+	if errors.Is(err, ErrInvalidInput) {
+		c.JSON(http.StatusBadRequest, common.ResponseError{Error: err.Error()})
+		return
+	}
+	if errors.Is(err, ErrEmailExists) {
+		c.JSON(http.StatusConflict, common.ResponseError{Error: "Email already exists"})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, common.ResponseError{Error: err.Error()})
+		common.InternalError(c, err)
 		return
 	}
 
@@ -66,6 +77,7 @@ func (h *Handler) Create(c *gin.Context) {
 // @Param page query int false "Page number" default(1) minimum(1)
 // @Param perPage query int false "Items per page" default(10) minimum(1) maximum(100)
 // @Param keyword query string false "Search keyword"
+// @Param asOf query string false "List the customers as they were at this RFC 3339 time" format(date-time)
 // @Success 200 {object} common.PaginatedResponse[CustomerTransformIndexOutput]
 // @Failure 400 {object} common.ResponseError
 // @Failure 500 {object} common.ResponseError
@@ -77,10 +89,10 @@ func (h *Handler) Index(c *gin.Context) {
 		return
 	}
 
-	customers, err := h.Service.FindAllAndCount(query)
+	customers, err := h.Service.FindAllAndCount(c.Request.Context(), query)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, common.ResponseError{Error: err.Error()})
+		common.InternalError(c, err)
 		return
 	}
 
@@ -103,6 +115,7 @@ func (h *Handler) Index(c *gin.Context) {
 // @Description Retrieve a single customer by their ID
 // @Produce  json
 // @Param id path int true "Customer ID"
+// @Param asOf query string false "Return the customer as it was at this RFC 3339 time" format(date-time)
 // @Success 200 {object} CustomerShowResponse
 // @Failure 400 {object} common.ResponseError
 // @Failure 404 {object} common.ResponseError
@@ -114,9 +127,20 @@ func (h *Handler) Show(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, common.ResponseError{Error: "invalid id"})
 		return
 	}
-	customer, err := h.Service.FindById(uint(id))
+	var query CustomerShowQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, common.ResponseError{Error: err.Error()})
+		return
+	}
+
+	var customer *Customer
+	if query.AsOf != nil {
+		customer, err = h.Service.FindByIdAsOf(c.Request.Context(), uint(id), *query.AsOf)
+	} else {
+		customer, err = h.Service.FindById(c.Request.Context(), uint(id))
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, common.ResponseError{Error: err.Error()})
+		common.InternalError(c, err)
 		return
 	}
 
@@ -147,41 +171,31 @@ func (h *Handler) Show(c *gin.Context) {
 // @Success 200 {object} map[string]interface{} "Updated customer ID"
 // @Failure 400 {object} common.ResponseError
 // @Failure 404 {object} common.ResponseError
+// @Failure 409 {object} common.ResponseError
 // @Failure 500 {object} common.ResponseError
 // @Router /customers/{id} [put]
 func (h *Handler) Update(c *gin.Context) {
 
+	logger := logging.FromContext(c.Request.Context())
 	var body CustomerUpdateBody
 
 	if err := c.ShouldBindJSON(&body); err != nil {
-		fmt.Println("Bind JSON error:", err)
+		logger.Debug("bind JSON failed", "error", err)
 		c.JSON(http.StatusBadRequest, common.ResponseError{Error: err.Error()})
 		return
 	}
 
 	idParam := c.Param("id")
-	fmt.Println("Param id:", idParam)
+	logger.Debug("update customer", "id", idParam)
 
 	id, err := strconv.ParseUint(idParam, 10, 32)
 	if err != nil {
-		fmt.Println("Parse ID error:", err)
+		logger.Debug("parse id failed", "error", err)
 		c.JSON(http.StatusBadRequest, common.ResponseError{Error: "invalid customer ID"})
 		return
 	}
 
-	existingCustomer, err := h.Service.FindById(uint(id))
-	if err != nil {
-		fmt.Println("FindById error:", err)
-		c.JSON(http.StatusInternalServerError, common.ResponseError{Error: err.Error()})
-		return
-	}
-	if existingCustomer == nil {
-		fmt.Println("Customer not found")
-		c.JSON(http.StatusNotFound, common.ResponseError{Error: "customer not found"})
-		return
-	}
-
-	user := "email@mock.com"
+	user := common.Principal(c)
 	input := &CustomerServiceUpdateInput{
 		CustomerCreateBody: CustomerCreateBody{
 			NameTh: body.NameTh,
@@ -191,13 +205,25 @@ func (h *Handler) Update(c *gin.Context) {
 		UpdatedBy: user,
 	}
 
-	customerId, err := h.Service.UpdateById(uint(id), input)
+	customerId, err := h.Service.UpdateById(c.Request.Context(), uint(id), input)
+	if errors.Is(err, ErrInvalidInput) {
+		c.JSON(http.StatusBadRequest, common.ResponseError{Error: err.Error()})
+		return
+	}
+	if errors.Is(err, ErrEmailExists) {
+		c.JSON(http.StatusConflict, common.ResponseError{Error: "Email already exists"})
+		return
+	}
+	if errors.Is(err, ErrNotFound) {
+		logger.Debug("customer not found", "id", id)
+		c.JSON(http.StatusNotFound, common.ResponseError{Error: "customer not found"})
+		return
+	}
 	if err != nil {
-		fmt.Println("UpdateById error:", err)
-		c.JSON(http.StatusInternalServerError, common.ResponseError{Error: err.Error()})
+		common.InternalError(c, err)
 		return
 	}
-	fmt.Println("Update successful, customerId:", customerId)
+	logger.Debug("customer updated", "id", customerId)
 
 	c.JSON(http.StatusOK, gin.H{
 		"data": gin.H{
@@ -222,28 +248,137 @@ func (h *Handler) Delete(c *gin.Context) {
 		return
 	}
 
-	existingCustomer, err := h.Service.FindById(uint(id))
+	err = h.Service.DeleteById(c.Request.Context(), uint(id))
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, common.ResponseError{Error: "customer not found"})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, common.ResponseError{Error: err.Error()})
+		common.InternalError(c, err)
 		return
 	}
-	if existingCustomer == nil {
-		c.JSON(http.StatusNotFound, common.ResponseError{Error: "customer not found"})
+	c.Status(http.StatusNoContent)
+}
+
+// @Tags Customers
+// @Summary Restore a deleted customer
+// @Description Bring back a customer that was deleted
+// @Produce  json
+// @Param id path int true "Customer ID"
+// @Success 200 {object} map[string]interface{} "Restored customer ID"
+// @Failure 400 {object} common.ResponseError
+// @Failure 404 {object} common.ResponseError
+// @Failure 500 {object} common.ResponseError
+// @Router /customers/{id}/restore [post]
+func (h *Handler) Restore(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, common.ResponseError{Error: "invalid customer ID"})
 		return
 	}
 
-	if err := h.Service.DeleteById(uint(id)); err != nil {
-		c.JSON(http.StatusInternalServerError, common.ResponseError{Error: err.Error()})
+	err = h.Service.RestoreById(c.Request.Context(), uint(id))
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, common.ResponseError{Error: "deleted customer not found"})
+		return
+	}
+	if err != nil {
+		common.InternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"customerId": id,
+		},
+	})
+}
+
+// @Tags Customers
+// @Summary Purge a customer
+// @Description Remove a customer, deleted or not, for good. Its history is kept.
+// @Param id path int true "Customer ID"
+// @Success 204 {string} string "No Content"
+// @Failure 400 {object} common.ResponseError
+// @Failure 404 {object} common.ResponseError
+// @Failure 500 {object} common.ResponseError
+// @Router /customers/{id}/purge [delete]
+func (h *Handler) Purge(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, common.ResponseError{Error: "invalid customer ID"})
+		return
+	}
+
+	err = h.Service.PurgeById(c.Request.Context(), uint(id))
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, common.ResponseError{Error: "customer not found"})
+		return
+	}
+	if err != nil {
+		common.InternalError(c, err)
 		return
 	}
 	c.Status(http.StatusNoContent)
 }
 
+// @Tags Customers
+// @Summary Get the history of a customer
+// @Description Retrieve who changed a customer, when and how, newest first
+// @Produce  json
+// @Param id path int true "Customer ID"
+// @Param page query int false "Page number" default(1) minimum(1)
+// @Param perPage query int false "Items per page" default(10) minimum(1) maximum(100)
+// @Success 200 {object} common.PaginatedResponse[CustomerHistoryResponse]
+// @Failure 400 {object} common.ResponseError
+// @Failure 500 {object} common.ResponseError
+// @Router /customers/{id}/history [get]
+func (h *Handler) History(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, common.ResponseError{Error: "invalid customer ID"})
+		return
+	}
+	var query CustomerHistoryQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, common.ResponseError{Error: err.Error()})
+		return
+	}
+
+	history, err := h.Service.FindHistory(c.Request.Context(), uint(id), query.PaginationQuery)
+	if err != nil {
+		common.InternalError(c, err)
+		return
+	}
+
+	entries := make([]CustomerHistoryResponse, 0, len(history.Data))
+	for _, audit := range history.Data {
+		var changes map[string]AuditChange
+		if err := json.Unmarshal(audit.Changes, &changes); err != nil {
+			common.InternalError(c, err)
+			return
+		}
+		entries = append(entries, CustomerHistoryResponse{
+			Id:        audit.Id,
+			Action:    audit.Action,
+			Actor:     audit.Actor,
+			RequestId: audit.RequestId,
+			Changes:   changes,
+			CreatedAt: audit.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, common.BuildPaginatedResponseFromQuery(entries, int(history.TotalItems), query.PaginationQuery))
+}
+
 func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
 	customers := rg.Group("/customers")
-	customers.POST("/", IsEmailExisted(h.Service), h.Create)
+	customers.POST("/", h.Create)
 	customers.GET("/", h.Index)
 	customers.GET("/:id", h.Show)
-	customers.PUT("/:id", IsEmailExisted(h.Service), h.Update)
+	customers.PUT("/:id", h.Update)
 	customers.DELETE("/:id", h.Delete)
+	customers.POST("/:id/restore", h.Restore)
+	customers.DELETE("/:id/purge", h.Purge)
+	customers.GET("/:id/history", h.History)
 }
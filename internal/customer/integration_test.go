@@ -0,0 +1,323 @@
+package customer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"test-go/common"
+	"test-go/internal/testdb"
+	"test-go/pkg/outbox"
+	"test-go/pkg/pgnotify"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// openTestDatabase returns the test database with empty customer tables.
+func openTestDatabase(t *testing.T) *gorm.DB {
+	return testdb.Open(t, "customers", "customer_audit", "customer_versions", "outbox")
+}
+
+func TestIntegration_ConcurrentCreatesWithSameEmail(t *testing.T) {
+	db := openTestDatabase(t)
+	svc := NewService(NewRepository(db), NewUnitOfWork(db, NewRepository))
+
+	const attempts = 2
+	start := make(chan struct{})
+	errs := make([]error, attempts)
+	var wg sync.WaitGroup
+	for i := range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, errs[i] = svc.Create(context.Background(), &CustomerServiceCreateInput{
+				CustomerCreateBody: CustomerCreateBody{NameTh: "ทดสอบ", NameEn: "Race", Email: "race@example.com"},
+				CreatedBy:          "unit@test.com",
+			})
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		assert.ErrorIs(t, err, ErrEmailExists)
+	}
+	assert.Equal(t, 1, succeeded)
+
+	var count int64
+	require.NoError(t, db.Model(&Customer{}).Where("email = ?", "race@example.com").Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+
+	// the audit record of the failed create was rolled back with it
+	require.NoError(t, db.Model(&CustomerAudit{}).Where("action = ?", AuditActionCreate).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestIntegration_PointInTimeReads(t *testing.T) {
+	db := openTestDatabase(t)
+	svc := NewService(NewRepository(db), NewUnitOfWork(db, NewRepository))
+	ctx := common.WithPrincipal(context.Background(), "unit@test.com")
+
+	now := func() time.Time {
+		var at time.Time
+		require.NoError(t, db.Raw("SELECT clock_timestamp()").Scan(&at).Error)
+		return at
+	}
+	body := func(email string) CustomerCreateBody {
+		return CustomerCreateBody{NameTh: "ทดสอบ", NameEn: "Point", Email: email}
+	}
+
+	beforeCreate := now()
+	id, err := svc.Create(ctx, &CustomerServiceCreateInput{CustomerCreateBody: body("v1@example.com"), CreatedBy: "unit@test.com"})
+	require.NoError(t, err)
+	afterCreate := now()
+	_, err = svc.UpdateById(ctx, id, &CustomerServiceUpdateInput{CustomerCreateBody: body("v2@example.com"), UpdatedBy: "unit@test.com"})
+	require.NoError(t, err)
+	afterUpdate := now()
+	require.NoError(t, svc.DeleteById(ctx, id))
+	afterDelete := now()
+	require.NoError(t, svc.RestoreById(ctx, id))
+	afterRestore := now()
+
+	for _, tc := range []struct {
+		name  string
+		asOf  time.Time
+		email string // empty when the customer should not be visible
+	}{
+		{"before create", beforeCreate, ""},
+		{"after create", afterCreate, "v1@example.com"},
+		{"after update", afterUpdate, "v2@example.com"},
+		{"after delete", afterDelete, ""},
+		{"after restore", afterRestore, "v2@example.com"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			customer, err := svc.FindByIdAsOf(ctx, id, tc.asOf)
+			require.NoError(t, err)
+
+			asOf := tc.asOf
+			list, err := svc.FindAllAndCount(ctx, CustomerIndexQuery{
+				PaginationQuery: common.PaginationQuery{Page: 1, PerPage: 10},
+				AsOf:            &asOf,
+			})
+			require.NoError(t, err)
+
+			if tc.email == "" {
+				assert.Nil(t, customer)
+				assert.Equal(t, int64(0), list.TotalItems)
+				return
+			}
+			require.NotNil(t, customer)
+			assert.Equal(t, tc.email, customer.Email)
+			require.Len(t, list.Data, 1)
+			assert.Equal(t, tc.email, list.Data[0].Email)
+		})
+	}
+}
+
+func TestIntegration_EventStreamResumesFromLastEventID(t *testing.T) {
+	db := openTestDatabase(t)
+	svc := NewService(NewRepository(db), NewUnitOfWork(db, NewRepository))
+	create := func(email string) {
+		_, err := svc.Create(context.Background(), &CustomerServiceCreateInput{
+			CustomerCreateBody: CustomerCreateBody{NameTh: "ทดสอบ", NameEn: "Stream", Email: email},
+			CreatedBy:          "unit@test.com",
+		})
+		require.NoError(t, err)
+	}
+	create("first@example.com")
+	create("second@example.com")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	tail := outbox.NewTail(db, 50*time.Millisecond, 16)
+	go tail.Run(ctx)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(common.MockAuth("unit@test.com"))
+	NewStreamHandler(tail, time.Hour, AllowAuthenticated).RegisterRoutes(router.Group(""))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/customers/events", nil)
+	require.NoError(t, err)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	lines := bufio.NewScanner(resp.Body)
+	next := func() (id, eventType string, data CustomerEvent) {
+		for lines.Scan() {
+			line := lines.Text()
+			switch {
+			case strings.HasPrefix(line, "id:"):
+				id = strings.TrimSpace(strings.TrimPrefix(line, "id:"))
+			case strings.HasPrefix(line, "event:"):
+				eventType = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+			case strings.HasPrefix(line, "data:"):
+				require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), &data))
+			case line == "" && id != "":
+				return id, eventType, data
+			}
+		}
+		t.Fatalf("stream ended: %v", lines.Err())
+		return
+	}
+
+	id, eventType, data := next()
+	assert.Equal(t, "2", id, "the missed event comes first")
+	assert.Equal(t, EventCustomerCreated, eventType)
+	assert.Equal(t, "second@example.com", data.Customer.Email)
+
+	create("third@example.com")
+	id, _, data = next()
+	assert.Equal(t, "3", id)
+	assert.Equal(t, "third@example.com", data.Customer.Email)
+}
+
+func TestIntegration_EventStreamResumesFromTheLatestEventForAnUnknownID(t *testing.T) {
+	db := openTestDatabase(t)
+	svc := NewService(NewRepository(db), NewUnitOfWork(db, NewRepository))
+	create := func(email string) {
+		_, err := svc.Create(context.Background(), &CustomerServiceCreateInput{
+			CustomerCreateBody: CustomerCreateBody{NameTh: "ทดสอบ", NameEn: "Stream", Email: email},
+			CreatedBy:          "unit@test.com",
+		})
+		require.NoError(t, err)
+	}
+	create("first@example.com")
+	create("second@example.com")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	tail := outbox.NewTail(db, 50*time.Millisecond, 16)
+	go tail.Run(ctx)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(common.MockAuth("unit@test.com"))
+	NewStreamHandler(tail, time.Hour, AllowAuthenticated).RegisterRoutes(router.Group(""))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/customers/events", nil)
+	require.NoError(t, err)
+	req.Header.Set("Last-Event-ID", "999")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	create("third@example.com")
+	lines := bufio.NewScanner(resp.Body)
+	for lines.Scan() {
+		if id, ok := strings.CutPrefix(lines.Text(), "id:"); ok {
+			assert.Equal(t, "3", strings.TrimSpace(id), "the earlier events are not replayed")
+			return
+		}
+	}
+	t.Fatalf("stream ended: %v", lines.Err())
+}
+
+type recordingInvalidator struct {
+	ids chan uint
+	all chan struct{}
+}
+
+func (r *recordingInvalidator) Invalidate(ctx context.Context, id uint) { r.ids <- id }
+func (r *recordingInvalidator) InvalidateAll(ctx context.Context)       { r.all <- struct{}{} }
+
+func TestIntegration_ChangesInvalidateCachesOfEveryReplica(t *testing.T) {
+	db := openTestDatabase(t)
+	svc := NewService(NewRepository(db), NewUnitOfWork(db, NewRepository))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cache := &recordingInvalidator{ids: make(chan uint, 10), all: make(chan struct{}, 10)}
+	listener := pgnotify.NewListener(testdb.DSN(t), ChangeChannel, 10*time.Millisecond, 100*time.Millisecond)
+	InvalidateOnChange(listener, cache)
+	go listener.Run(ctx)
+
+	select {
+	case <-cache.all:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the listener did not connect")
+	}
+
+	id, err := svc.Create(ctx, &CustomerServiceCreateInput{
+		CustomerCreateBody: CustomerCreateBody{NameTh: "ทดสอบ", NameEn: "Notify", Email: "notify@example.com"},
+		CreatedBy:          "unit@test.com",
+	})
+	require.NoError(t, err)
+
+	select {
+	case invalidated := <-cache.ids:
+		assert.Equal(t, id, invalidated)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the change was not notified")
+	}
+}
+
+func TestIntegration_BulkCreateOpensVersionsAndInvalidatesEveryReplica(t *testing.T) {
+	db := openTestDatabase(t)
+	repo := NewRepository(db)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cache := &recordingInvalidator{ids: make(chan uint, 10), all: make(chan struct{}, 10)}
+	listener := pgnotify.NewListener(testdb.DSN(t), ChangeChannel, 10*time.Millisecond, 100*time.Millisecond)
+	InvalidateOnChange(listener, cache)
+	go listener.Run(ctx)
+	select {
+	case <-cache.all:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the listener did not connect")
+	}
+
+	createdAt := time.Now().Add(-48 * time.Hour).UTC().Truncate(time.Microsecond)
+	copied, err := repo.BulkCreate(ctx, []Customer{
+		{Id: 7, NameTh: "แอน", NameEn: "Ann", Email: "ann@example.com", CreatedBy: "seed", CreatedAt: createdAt, UpdatedBy: "seed", UpdatedAt: createdAt},
+		{Id: 9, NameTh: "บ๊อบ", NameEn: "Bob", Email: "bob@example.com", CreatedBy: "seed", CreatedAt: createdAt, UpdatedBy: "seed", UpdatedAt: createdAt},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), copied)
+
+	select {
+	case <-cache.all:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the bulk load was not notified")
+	}
+
+	customer, err := repo.FindByIdAsOf(ctx, 9, createdAt.Add(25*time.Hour))
+	require.NoError(t, err)
+	require.NotNil(t, customer, "bulk loaded customers have a version since their creation")
+	assert.Equal(t, "bob@example.com", customer.Email)
+	customer, err = repo.FindByIdAsOf(ctx, 9, createdAt.Add(-25*time.Hour))
+	require.NoError(t, err)
+	assert.Nil(t, customer)
+
+	copied, err = repo.BulkCreate(ctx, []Customer{{NameTh: "ซี", NameEn: "Cee", Email: "cee@example.com", CreatedBy: "seed", CreatedAt: createdAt, UpdatedBy: "seed", UpdatedAt: createdAt}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), copied)
+	page, err := repo.FindAllAndCountAsOf(ctx, "", 1, 10, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), page.TotalItems)
+	assert.Equal(t, uint(10), page.Data[2].Id, "the sequence moved past the imported ids")
+}
@@ -0,0 +1,50 @@
+package customer
+
+import (
+	"context"
+	"strconv"
+	"test-go/pkg/logging"
+	"test-go/pkg/pgnotify"
+)
+
+// ChangeChannel is the notification channel announcing, with the customer id
+// as payload, that a customer changed, or with everyCustomer that any may
+// have.
+const ChangeChannel = "customer_changed"
+
+// everyCustomer is the payload of the notifications of bulk loads.
+const everyCustomer = "*"
+
+// Invalidator drops what a replica cached about customers.
+type Invalidator interface {
+	Invalidate(ctx context.Context, id uint)
+	InvalidateAll(ctx context.Context)
+}
+
+// InvalidateOnChange makes listener, which must listen on ChangeChannel,
+// invalidate the customers that any replica changes in caches. Everything is
+// invalidated whenever the listener (re)connects, since changes notified
+// while it was disconnected are lost.
+func InvalidateOnChange(listener *pgnotify.Listener, caches ...Invalidator) {
+	listener.OnConnect(func(ctx context.Context) {
+		for _, cache := range caches {
+			cache.InvalidateAll(ctx)
+		}
+	})
+	listener.OnNotify(func(ctx context.Context, payload string) {
+		if payload == everyCustomer {
+			for _, cache := range caches {
+				cache.InvalidateAll(ctx)
+			}
+			return
+		}
+		id, err := strconv.ParseUint(payload, 10, 32)
+		if err != nil {
+			logging.FromContext(ctx).WarnContext(ctx, "ignored invalid customer change notification", "payload", payload)
+			return
+		}
+		for _, cache := range caches {
+			cache.Invalidate(ctx, uint(id))
+		}
+	})
+}
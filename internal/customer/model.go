@@ -1,15 +1,123 @@
 package customer
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"test-go/pkg/logging"
+	"time"
+)
 
 type Customer struct {
-	Id        uint      `gorm:"primaryKey" json:"id"`
+	Id        uint      `gorm:"primaryKey;type:serial" json:"id"`
 	NameTh    string    `json:"name_th"`
 	NameEn    string    `json:"name_en"`
-	Email     string    `json:"email"`
-	IsDeleted bool      `json:"is_deleted"`
+	Email     string    `gorm:"unique" json:"email"`
+	IsDeleted bool      `gorm:"default:false" json:"is_deleted"`
 	CreatedBy string    `json:"created_by"`
-	CreatedAt time.Time `json:"created_at"`
+	CreatedAt time.Time `gorm:"type:timestamp" json:"created_at"`
 	UpdatedBy string    `json:"updated_by"`
-	UpdatedAt time.Time `json:"updated_at"`
+	UpdatedAt time.Time `gorm:"type:timestamp" json:"updated_at"`
+}
+
+// String masks the names and the email, since a customer formatted into an
+// error or a panic reaches the logs as free text, where names can not be told
+// apart from the rest.
+func (c Customer) String() string {
+	return fmt.Sprintf("Customer{Id:%d NameTh:%s NameEn:%s Email:%s IsDeleted:%t}",
+		c.Id, logging.MaskName(c.NameTh), logging.MaskName(c.NameEn), logging.MaskEmail(c.Email), c.IsDeleted)
+}
+
+// LogValue logs the customer with its names and email masked.
+func (c Customer) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Uint64("id", uint64(c.Id)),
+		slog.String("name_th", logging.MaskName(c.NameTh)),
+		slog.String("name_en", logging.MaskName(c.NameEn)),
+		slog.String("email", logging.MaskEmail(c.Email)),
+		slog.Bool("is_deleted", c.IsDeleted),
+	)
+}
+
+// Audit actions recorded for customer changes.
+const (
+	AuditActionCreate  = "create"
+	AuditActionUpdate  = "update"
+	AuditActionDelete  = "delete"
+	AuditActionRestore = "restore"
+	AuditActionPurge   = "purge"
+)
+
+// Types of the events published for customer changes, one per audit action.
+const (
+	EventCustomerCreated  = "CustomerCreated"
+	EventCustomerUpdated  = "CustomerUpdated"
+	EventCustomerDeleted  = "CustomerDeleted"
+	EventCustomerRestored = "CustomerRestored"
+	EventCustomerPurged   = "CustomerPurged"
+)
+
+var eventTypes = map[string]string{
+	AuditActionCreate:  EventCustomerCreated,
+	AuditActionUpdate:  EventCustomerUpdated,
+	AuditActionDelete:  EventCustomerDeleted,
+	AuditActionRestore: EventCustomerRestored,
+	AuditActionPurge:   EventCustomerPurged,
+}
+
+// CustomerEvent is the payload of a customer event. Customer is the state
+// after the change, nil when the customer was purged.
+type CustomerEvent struct {
+	CustomerId uint      `json:"customerId"`
+	Customer   *Customer `json:"customer"`
+	Actor      string    `json:"actor"`
+	RequestId  string    `json:"requestId"`
+}
+
+// CustomerAudit records one change of a customer. Changes maps every changed
+// field to its value before and after the change.
+type CustomerAudit struct {
+	Id         uint64          `gorm:"primaryKey;type:bigserial;index:customer_audit_customer_id_idx,priority:2" json:"id"`
+	CustomerId uint            `gorm:"type:integer;index:customer_audit_customer_id_idx,priority:1" json:"customer_id"`
+	Action     string          `json:"action"`
+	Actor      string          `json:"actor"`
+	RequestId  string          `json:"request_id"`
+	Changes    json.RawMessage `gorm:"type:jsonb;not null" json:"changes"`
+	CreatedAt  time.Time       `gorm:"type:timestamp" json:"created_at"`
+}
+
+func (CustomerAudit) TableName() string {
+	return "customer_audit"
+}
+
+// CustomerVersion is the state of a customer from ValidFrom until ValidTo,
+// which is nil for the current state.
+type CustomerVersion struct {
+	Id         uint64     `gorm:"primaryKey;type:bigserial" json:"id"`
+	CustomerId uint       `gorm:"type:integer;index:customer_versions_customer_id_idx,priority:1" json:"customer_id"`
+	NameTh     string     `json:"name_th"`
+	NameEn     string     `json:"name_en"`
+	Email      string     `json:"email"`
+	IsDeleted  bool       `json:"is_deleted"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `gorm:"type:timestamp" json:"created_at"`
+	UpdatedBy  string     `json:"updated_by"`
+	UpdatedAt  time.Time  `gorm:"type:timestamp" json:"updated_at"`
+	ValidFrom  time.Time  `gorm:"type:timestamptz;index:customer_versions_customer_id_idx,priority:2" json:"valid_from"`
+	ValidTo    *time.Time `gorm:"type:timestamptz" json:"valid_to"`
+}
+
+// Customer returns the customer as it was during the version.
+func (v CustomerVersion) Customer() Customer {
+	return Customer{
+		Id:        v.CustomerId,
+		NameTh:    v.NameTh,
+		NameEn:    v.NameEn,
+		Email:     v.Email,
+		IsDeleted: v.IsDeleted,
+		CreatedBy: v.CreatedBy,
+		CreatedAt: v.CreatedAt,
+		UpdatedBy: v.UpdatedBy,
+		UpdatedAt: v.UpdatedAt,
+	}
 }
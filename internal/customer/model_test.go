@@ -0,0 +1,29 @@
+package customer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"test-go/pkg/logging"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCustomer_IsMaskedInLogs(t *testing.T) {
+	customer := &Customer{Id: 7, NameTh: "สมชาย ใจดี", NameEn: "Somchai Jaidee", Email: "somchai@example.com"}
+	body := CustomerCreateBody{NameTh: "สมหญิง", NameEn: "Somying", Email: "somying@example.com"}
+
+	var buf bytes.Buffer
+	logging.New(&buf, "info").Error("failed to save customer",
+		"error", fmt.Errorf("failed to update %v: %w", customer, errors.New("deadlock")),
+		"panic", fmt.Sprint(body),
+		"customer", *customer,
+	)
+
+	for _, name := range []string{"สมชาย", "ใจดี", "Somchai", "Jaidee", "somchai@", "สมหญิง", "Somying", "somying@"} {
+		assert.NotContains(t, buf.String(), name)
+	}
+	assert.Contains(t, buf.String(), "failed to update Customer{Id:7 NameTh:ส**** NameEn:S**** Email:s****@example.com IsDeleted:false}: deadlock")
+	assert.Contains(t, buf.String(), `"customer":{"id":7,"name_th":"ส****"`)
+}
@@ -1,18 +1,53 @@
 package customer
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	database "test-go/pkg/db"
+	"test-go/pkg/outbox"
+	"test-go/pkg/pgnotify"
+	"test-go/pkg/tracing"
+	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/stdlib"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Repository interface {
-	Create(customer *Customer) error
-	FindAllAndCount(keyword string, page, perPage int) (CustomerServiceFindAllAndCount, error)
-	FindById(id uint) (*Customer, error)
-	UpdateById(customer *Customer) error
-	DeleteById(id uint) error
-	FindByEmail(email string, excludeId *uint) (*Customer, error)
+	Create(ctx context.Context, customer *Customer) error
+	FindAllAndCount(ctx context.Context, keyword string, page, perPage int) (CustomerServiceFindAllAndCount, error)
+	FindById(ctx context.Context, id uint) (*Customer, error)
+	UpdateById(ctx context.Context, customer *Customer) error
+	DeleteById(ctx context.Context, id uint) error
+	FindByEmail(ctx context.Context, email string, excludeId *uint) (*Customer, error)
+	BulkCreate(ctx context.Context, customers []Customer) (int64, error)
+	FindInBatches(ctx context.Context, batchSize int, fn func(batch []Customer) error) error
+	// LockById returns the customer, deleted or not, and locks its row until
+	// the end of the transaction. It returns nil when there is no such customer.
+	LockById(ctx context.Context, id uint) (*Customer, error)
+	RestoreById(ctx context.Context, id uint) error
+	PurgeById(ctx context.Context, id uint) error
+	CreateAudit(ctx context.Context, audit *CustomerAudit) error
+	FindAuditsAndCount(ctx context.Context, customerId uint, page, perPage int) ([]CustomerAudit, int64, error)
+	// RecordVersion closes the current version of the customer and, unless
+	// state is nil because the customer was purged, opens one holding state.
+	RecordVersion(ctx context.Context, customerId uint, state *Customer) error
+	FindByIdAsOf(ctx context.Context, id uint, asOf time.Time) (*Customer, error)
+	FindAllAndCountAsOf(ctx context.Context, keyword string, page, perPage int, asOf time.Time) (CustomerServiceFindAllAndCount, error)
+	// RecordEvent adds event to the outbox, to be published once the
+	// transaction of the repository commits.
+	RecordEvent(ctx context.Context, event *outbox.Event) error
+	// NotifyChanged tells every replica, once the transaction of the
+	// repository commits, that the customer changed.
+	NotifyChanged(ctx context.Context, id uint) error
 }
 
 type repository struct {
@@ -23,16 +58,24 @@ func NewRepository(db *gorm.DB) Repository {
 	return &repository{db}
 }
 
-func (r *repository) Create(customer *Customer) error {
-	return r.db.Create(customer).Error
+func (r *repository) Create(ctx context.Context, customer *Customer) (err error) {
+	ctx, span := tracer.Start(ctx, "customer.Repository.Create")
+	defer func() { tracing.End(span, err) }()
+
+	return translateError(r.db.WithContext(ctx).Create(customer).Error)
 }
 
-func (r *repository) FindAllAndCount(keyword string, page, perPage int) (CustomerServiceFindAllAndCount, error) {
+func (r *repository) FindAllAndCount(ctx context.Context, keyword string, page, perPage int) (_ CustomerServiceFindAllAndCount, err error) {
+	ctx, span := tracer.Start(ctx, "customer.Repository.FindAllAndCount")
+	defer func() { tracing.End(span, err) }()
+	// ค้นหาด้วย ILIKE อาจช้าเมื่อข้อมูลเยอะ ขอ query plan เมื่อ query ช้า
+	ctx = database.ExplainIfSlow(ctx)
+
 	var result CustomerServiceFindAllAndCount
 	var customers []Customer
 	var total int64
 
-	db := r.db.Model(&Customer{})
+	db := r.db.WithContext(ctx).Model(&Customer{})
 
 	// กรองข้อมูลที่ยังไม่ถูกลบ (is_deleted = false หรือ IS NULL)
 	db = db.Where("is_deleted IS NULL OR is_deleted = ?", false)
@@ -61,9 +104,12 @@ func (r *repository) FindAllAndCount(keyword string, page, perPage int) (Custome
 	return result, nil
 }
 
-func (r *repository) FindById(id uint) (*Customer, error) {
+func (r *repository) FindById(ctx context.Context, id uint) (_ *Customer, err error) {
+	ctx, span := tracer.Start(ctx, "customer.Repository.FindById")
+	defer func() { tracing.End(span, err) }()
+
 	var customer Customer
-	err := r.db.
+	err = r.db.WithContext(ctx).
 		Where("id = ? AND (is_deleted IS NULL OR is_deleted = false)", id).
 		First(&customer).Error
 
@@ -73,30 +119,38 @@ func (r *repository) FindById(id uint) (*Customer, error) {
 	return &customer, err
 }
 
-func (r *repository) UpdateById(customer *Customer) error {
+func (r *repository) UpdateById(ctx context.Context, customer *Customer) (err error) {
+	ctx, span := tracer.Start(ctx, "customer.Repository.UpdateById")
+	defer func() { tracing.End(span, err) }()
 
-	return r.db.Model(&Customer{}).Where("id = ?", customer.Id).Updates(customer).Error
+	return translateError(r.db.WithContext(ctx).Model(&Customer{}).Where("id = ?", customer.Id).Updates(customer).Error)
 }
 
-func (r *repository) DeleteById(id uint) error {
-	return r.db.Model(&Customer{}).
+func (r *repository) DeleteById(ctx context.Context, id uint) (err error) {
+	ctx, span := tracer.Start(ctx, "customer.Repository.DeleteById")
+	defer func() { tracing.End(span, err) }()
+
+	return r.db.WithContext(ctx).Model(&Customer{}).
 		Where("id = ?", id).
 		Updates(Customer{
 			IsDeleted: true,
 		}).Error
 }
 
-func (r *repository) FindByEmail(email string, excludeId *uint) (*Customer, error) {
+func (r *repository) FindByEmail(ctx context.Context, email string, excludeId *uint) (_ *Customer, err error) {
+	ctx, span := tracer.Start(ctx, "customer.Repository.FindByEmail")
+	defer func() { tracing.End(span, err) }()
+
 	var customer Customer
 
-	db := r.db.Model(&Customer{}).
+	db := r.db.WithContext(ctx).Model(&Customer{}).
 		Where("email = ? AND (is_deleted IS NULL OR is_deleted = false)", email)
 
 	if excludeId != nil {
 		db = db.Where("id != ?", *excludeId)
 	}
 
-	err := db.First(&customer).Error
+	err = db.First(&customer).Error
 
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, nil
@@ -108,3 +162,283 @@ func (r *repository) FindByEmail(email string, excludeId *uint) (*Customer, erro
 
 	return &customer, nil
 }
+
+func (r *repository) LockById(ctx context.Context, id uint) (_ *Customer, err error) {
+	ctx, span := tracer.Start(ctx, "customer.Repository.LockById")
+	defer func() { tracing.End(span, err) }()
+
+	var customer Customer
+	err = r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", id).
+		First(&customer).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &customer, nil
+}
+
+func (r *repository) RestoreById(ctx context.Context, id uint) (err error) {
+	ctx, span := tracer.Start(ctx, "customer.Repository.RestoreById")
+	defer func() { tracing.End(span, err) }()
+
+	return r.db.WithContext(ctx).Model(&Customer{}).
+		Where("id = ?", id).
+		Update("is_deleted", false).Error
+}
+
+// PurgeById deletes the customer row for good. Its audit records are kept.
+func (r *repository) PurgeById(ctx context.Context, id uint) (err error) {
+	ctx, span := tracer.Start(ctx, "customer.Repository.PurgeById")
+	defer func() { tracing.End(span, err) }()
+
+	return r.db.WithContext(ctx).Delete(&Customer{}, id).Error
+}
+
+func (r *repository) CreateAudit(ctx context.Context, audit *CustomerAudit) (err error) {
+	ctx, span := tracer.Start(ctx, "customer.Repository.CreateAudit")
+	defer func() { tracing.End(span, err) }()
+
+	return r.db.WithContext(ctx).Create(audit).Error
+}
+
+func (r *repository) RecordEvent(ctx context.Context, event *outbox.Event) (err error) {
+	ctx, span := tracer.Start(ctx, "customer.Repository.RecordEvent")
+	defer func() { tracing.End(span, err) }()
+
+	return outbox.Append(r.db.WithContext(ctx), event)
+}
+
+func (r *repository) NotifyChanged(ctx context.Context, id uint) (err error) {
+	ctx, span := tracer.Start(ctx, "customer.Repository.NotifyChanged")
+	defer func() { tracing.End(span, err) }()
+
+	return pgnotify.Notify(r.db.WithContext(ctx), ChangeChannel, strconv.FormatUint(uint64(id), 10))
+}
+
+// FindAuditsAndCount pages through the audit records of a customer, newest first.
+func (r *repository) FindAuditsAndCount(ctx context.Context, customerId uint, page, perPage int) (_ []CustomerAudit, _ int64, err error) {
+	ctx, span := tracer.Start(ctx, "customer.Repository.FindAuditsAndCount")
+	defer func() { tracing.End(span, err) }()
+
+	var audits []CustomerAudit
+	var total int64
+
+	db := r.db.WithContext(ctx).Model(&CustomerAudit{}).Where("customer_id = ?", customerId)
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = db.Order("id DESC").Limit(perPage).Offset((page - 1) * perPage).Find(&audits).Error
+	return audits, total, err
+}
+
+// RecordVersion takes the version boundary from the database clock when it is
+// called, after the customer row was locked, so versions of concurrent writes
+// never overlap.
+func (r *repository) RecordVersion(ctx context.Context, customerId uint, state *Customer) (err error) {
+	ctx, span := tracer.Start(ctx, "customer.Repository.RecordVersion")
+	defer func() { tracing.End(span, err) }()
+
+	db := r.db.WithContext(ctx)
+
+	var at time.Time
+	if err := db.Raw("SELECT clock_timestamp()").Scan(&at).Error; err != nil {
+		return err
+	}
+
+	err = db.Model(&CustomerVersion{}).
+		Where("customer_id = ? AND valid_to IS NULL", customerId).
+		Update("valid_to", at).Error
+	if err != nil || state == nil {
+		return err
+	}
+
+	return db.Create(&CustomerVersion{
+		CustomerId: customerId,
+		NameTh:     state.NameTh,
+		NameEn:     state.NameEn,
+		Email:      state.Email,
+		IsDeleted:  state.IsDeleted,
+		CreatedBy:  state.CreatedBy,
+		CreatedAt:  state.CreatedAt,
+		UpdatedBy:  state.UpdatedBy,
+		UpdatedAt:  state.UpdatedAt,
+		ValidFrom:  at,
+	}).Error
+}
+
+// versionsAsOf selects the versions that were current at asOf.
+func (r *repository) versionsAsOf(ctx context.Context, asOf time.Time) *gorm.DB {
+	return r.db.WithContext(ctx).Model(&CustomerVersion{}).
+		Where("valid_from <= ? AND (valid_to IS NULL OR valid_to > ?)", asOf, asOf)
+}
+
+// FindByIdAsOf returns the customer as it was at asOf, or nil when it did not
+// exist or was deleted then.
+func (r *repository) FindByIdAsOf(ctx context.Context, id uint, asOf time.Time) (_ *Customer, err error) {
+	ctx, span := tracer.Start(ctx, "customer.Repository.FindByIdAsOf")
+	defer func() { tracing.End(span, err) }()
+
+	var version CustomerVersion
+	err = r.versionsAsOf(ctx, asOf).
+		Where("customer_id = ? AND is_deleted = false", id).
+		First(&version).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	customer := version.Customer()
+	return &customer, nil
+}
+
+// FindAllAndCountAsOf lists the customers that existed and were not deleted
+// at asOf, in their state then, filtered like FindAllAndCount.
+func (r *repository) FindAllAndCountAsOf(ctx context.Context, keyword string, page, perPage int, asOf time.Time) (_ CustomerServiceFindAllAndCount, err error) {
+	ctx, span := tracer.Start(ctx, "customer.Repository.FindAllAndCountAsOf")
+	defer func() { tracing.End(span, err) }()
+	ctx = database.ExplainIfSlow(ctx)
+
+	var result CustomerServiceFindAllAndCount
+	var versions []CustomerVersion
+	var total int64
+
+	db := r.versionsAsOf(ctx, asOf).Where("is_deleted = false")
+	if keyword != "" {
+		likePattern := "%" + keyword + "%"
+		db = db.Where("name_th ILIKE ? OR name_en ILIKE ? OR email ILIKE ?", likePattern, likePattern, likePattern)
+	}
+
+	if err := db.Count(&total).Error; err != nil {
+		return result, err
+	}
+	if err := db.Order("customer_id").Limit(perPage).Offset((page - 1) * perPage).Find(&versions).Error; err != nil {
+		return result, err
+	}
+
+	result.Data = make([]Customer, len(versions))
+	for i, version := range versions {
+		result.Data[i] = version.Customer()
+	}
+	result.TotalItems = total
+	return result, nil
+}
+
+const (
+	// emailUniqueConstraint is the unique constraint on customers.email, which
+	// makes email uniqueness hold under concurrent writes.
+	emailUniqueConstraint = "customers_email_key"
+	uniqueViolation       = "23505"
+)
+
+// translateError turns violations of the email constraint into ErrEmailExists.
+func translateError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation && pgErr.ConstraintName == emailUniqueConstraint {
+		return fmt.Errorf("%w: %s", ErrEmailExists, pgErr.ConstraintName)
+	}
+	return err
+}
+
+// BulkCreate inserts customers with a single COPY, which is much faster than
+// batched INSERTs for large volumes. When the customers carry ids (ex. an
+// import) the ids are kept and the id sequence is moved past them, otherwise
+// the database assigns them. Each customer gets its first version, valid since
+// it was created, in the same transaction. Bulk loads record no audit and no
+// outbox event, so streams and webhooks do not hear of them; every replica is
+// told to drop its cached customers instead.
+func (r *repository) BulkCreate(ctx context.Context, customers []Customer) (_ int64, err error) {
+	ctx, span := tracer.Start(ctx, "customer.Repository.BulkCreate", trace.WithAttributes(attribute.Int("customer.count", len(customers))))
+	defer func() { tracing.End(span, err) }()
+
+	if len(customers) == 0 {
+		return 0, nil
+	}
+
+	sqlDB, err := r.db.DB()
+	if err != nil {
+		return 0, err
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	withIds := customers[0].Id != 0
+	columns := []string{"name_th", "name_en", "email", "is_deleted", "created_by", "created_at", "updated_by", "updated_at"}
+	if withIds {
+		columns = append([]string{"id"}, columns...)
+	}
+
+	rows := make([][]interface{}, len(customers))
+	for i, c := range customers {
+		rows[i] = []interface{}{c.NameTh, c.NameEn, c.Email, c.IsDeleted, c.CreatedBy, c.CreatedAt, c.UpdatedBy, c.UpdatedAt}
+		if withIds {
+			rows[i] = append([]interface{}{int64(c.Id)}, rows[i]...)
+		}
+	}
+
+	var created int64
+	err = conn.Raw(func(driverConn interface{}) error {
+		stdConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("bulk create requires the pgx driver, got %T", driverConn)
+		}
+		return pgx.BeginFunc(ctx, stdConn.Conn(), func(tx pgx.Tx) error {
+			created, err = bulkCreate(ctx, tx, columns, rows, withIds)
+			return err
+		})
+	})
+	return created, err
+}
+
+// bulkCreate copies rows into a staging table, then moves them to customers
+// while opening their first versions.
+func bulkCreate(ctx context.Context, tx pgx.Tx, columns []string, rows [][]interface{}, withIds bool) (int64, error) {
+	list := strings.Join(columns, ", ")
+	_, err := tx.Exec(ctx, `CREATE TEMP TABLE customers_bulk ON COMMIT DROP AS SELECT `+list+` FROM customers WITH NO DATA`)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"customers_bulk"}, columns, pgx.CopyFromRows(rows)); err != nil {
+		return 0, err
+	}
+
+	tag, err := tx.Exec(ctx, `WITH created AS (
+		INSERT INTO customers (`+list+`) SELECT `+list+` FROM customers_bulk
+		RETURNING id, name_th, name_en, email, is_deleted, created_by, created_at, updated_by, updated_at
+	)
+	INSERT INTO customer_versions (customer_id, name_th, name_en, email, is_deleted, created_by, created_at, updated_by, updated_at, valid_from)
+	SELECT id, name_th, name_en, email, is_deleted, created_by, created_at, updated_by, updated_at, created_at FROM created`)
+	if err != nil {
+		return 0, translateError(err)
+	}
+
+	if withIds {
+		_, err = tx.Exec(ctx, `SELECT setval(pg_get_serial_sequence('customers', 'id'), (SELECT MAX(id) FROM customers))`)
+		if err != nil {
+			return 0, err
+		}
+	}
+	_, err = tx.Exec(ctx, `SELECT pg_notify($1, $2)`, ChangeChannel, everyCustomer)
+	return tag.RowsAffected(), err
+}
+
+// FindInBatches walks every customer, including deleted ones, in id order.
+func (r *repository) FindInBatches(ctx context.Context, batchSize int, fn func(batch []Customer) error) (err error) {
+	ctx, span := tracer.Start(ctx, "customer.Repository.FindInBatches")
+	defer func() { tracing.End(span, err) }()
+
+	var customers []Customer
+	return r.db.WithContext(ctx).Model(&Customer{}).FindInBatches(&customers, batchSize, func(tx *gorm.DB, batch int) error {
+		return fn(customers)
+	}).Error
+}
@@ -5,9 +5,16 @@ import (
 	"gorm.io/gorm"
 )
 
-func RegisterRoutes(rg *gin.RouterGroup, db *gorm.DB) {
+// RegisterRoutes registers the customer routes, reading customers through
+// cache unless it is nil.
+func RegisterRoutes(rg *gin.RouterGroup, db *gorm.DB, cache *RepositoryCache) {
 	repo := NewRepository(db)
-	service := NewService(repo)
+	newRepository := NewRepository
+	if cache != nil {
+		repo = cache.Wrap(repo)
+		newRepository = func(tx *gorm.DB) Repository { return cache.WrapTx(NewRepository(tx)) }
+	}
+	service := NewService(repo, NewUnitOfWork(db, newRepository))
 	handler := NewHandler(repo, service)
 	handler.RegisterRoutes(rg)
 }
@@ -1,28 +1,64 @@
 package customer
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"test-go/common"
+	"test-go/pkg/metrics"
+	"test-go/pkg/tracing"
 	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("test-go/internal/customer")
+
+var (
+	ErrInvalidInput = errors.New("invalid customer input")
+	// ErrEmailExists is returned when another customer, deleted or not, already
+	// has the email. The database constraint decides, so it holds even for
+	// concurrent writes.
+	ErrEmailExists = errors.New("email already exists")
+	ErrNotFound    = errors.New("customer not found")
 )
 
 type Service interface {
-	Create(customer *CustomerServiceCreateInput) (uint, error)
-	FindAllAndCount(filter CustomerIndexQuery) (CustomerServiceFindAllAndCount, error)
-	UpdateById(id uint, input *CustomerServiceUpdateInput) (uint, error)
-	DeleteById(id uint) error
+	Create(ctx context.Context, customer *CustomerServiceCreateInput) (uint, error)
+	FindAllAndCount(ctx context.Context, filter CustomerIndexQuery) (CustomerServiceFindAllAndCount, error)
+	UpdateById(ctx context.Context, id uint, input *CustomerServiceUpdateInput) (uint, error)
+	DeleteById(ctx context.Context, id uint) error
 	TransformCustomerIndex(customer *Customer) CustomerTransformIndexOutput
-	FindById(id uint) (*Customer, error)
-	FindByEmail(email string, excludeId *uint) (*Customer, error)
+	FindById(ctx context.Context, id uint) (*Customer, error)
+	FindByIdAsOf(ctx context.Context, id uint, asOf time.Time) (*Customer, error)
+	FindByEmail(ctx context.Context, email string, excludeId *uint) (*Customer, error)
+	RestoreById(ctx context.Context, id uint) error
+	PurgeById(ctx context.Context, id uint) error
+	FindHistory(ctx context.Context, id uint, query common.PaginationQuery) (CustomerServiceFindHistory, error)
 }
 
 type service struct {
 	repo Repository
+	uow  UnitOfWork
 }
 
-func NewService(r Repository) Service {
-	return &service{repo: r}
+// NewService reads through r and runs every write in a transaction of uow.
+func NewService(r Repository, uow UnitOfWork) Service {
+	return &service{repo: r, uow: uow}
 }
 
-func (s *service) Create(input *CustomerServiceCreateInput) (uint, error) {
+func (s *service) Create(ctx context.Context, input *CustomerServiceCreateInput) (_ uint, err error) {
+	ctx, span := tracer.Start(ctx, "customer.Service.Create")
+	defer func() { tracing.End(span, err) }()
+
+	if err := normalizeAndValidate(&input.CustomerCreateBody); err != nil {
+		return 0, err
+	}
+
 	now := time.Now()
 	customer := &Customer{
 		NameTh:    input.NameTh,
@@ -34,23 +70,42 @@ func (s *service) Create(input *CustomerServiceCreateInput) (uint, error) {
 		UpdatedAt: now,
 	}
 
-	err := s.repo.Create(customer)
+	err = s.uow.Do(ctx, func(repo Repository) error {
+		if err := repo.Create(ctx, customer); err != nil {
+			return err
+		}
+		return recordChange(ctx, repo, AuditActionCreate, input.CreatedBy, customer.Id, nil, customer)
+	})
 	if err != nil {
 		return 0, err
 	}
+	metrics.CustomersCreated.Inc()
 	return customer.Id, nil
 }
 
-func (s *service) FindAllAndCount(filter CustomerIndexQuery) (CustomerServiceFindAllAndCount, error) {
+func (s *service) FindAllAndCount(ctx context.Context, filter CustomerIndexQuery) (_ CustomerServiceFindAllAndCount, err error) {
+	ctx, span := tracer.Start(ctx, "customer.Service.FindAllAndCount")
+	defer func() { tracing.End(span, err) }()
+
 	keyword := ""
 	if filter.Keyword != nil {
 		keyword = *filter.Keyword
 	}
 
-	return s.repo.FindAllAndCount(keyword, filter.Page, filter.PerPage)
+	if filter.AsOf != nil {
+		return s.repo.FindAllAndCountAsOf(ctx, keyword, filter.Page, filter.PerPage, *filter.AsOf)
+	}
+	return s.repo.FindAllAndCount(ctx, keyword, filter.Page, filter.PerPage)
 }
 
-func (s *service) UpdateById(id uint, input *CustomerServiceUpdateInput) (uint, error) {
+func (s *service) UpdateById(ctx context.Context, id uint, input *CustomerServiceUpdateInput) (_ uint, err error) {
+	ctx, span := tracer.Start(ctx, "customer.Service.UpdateById", trace.WithAttributes(attribute.Int64("customer.id", int64(id))))
+	defer func() { tracing.End(span, err) }()
+
+	if err := normalizeAndValidate(&input.CustomerCreateBody); err != nil {
+		return 0, err
+	}
+
 	now := time.Now()
 	customer := &Customer{
 		Id:        id,
@@ -61,13 +116,112 @@ func (s *service) UpdateById(id uint, input *CustomerServiceUpdateInput) (uint,
 		UpdatedAt: now,
 	}
 
-	s.repo.UpdateById(customer)
+	err = s.uow.Do(ctx, func(repo Repository) error {
+		before, err := repo.LockById(ctx, id)
+		if err != nil {
+			return err
+		}
+		if before == nil || before.IsDeleted {
+			return ErrNotFound
+		}
+		if err := repo.UpdateById(ctx, customer); err != nil {
+			return err
+		}
 
+		after := *before
+		after.NameTh, after.NameEn, after.Email = customer.NameTh, customer.NameEn, customer.Email
+		after.UpdatedBy, after.UpdatedAt = customer.UpdatedBy, customer.UpdatedAt
+		return recordChange(ctx, repo, AuditActionUpdate, input.UpdatedBy, id, before, &after)
+	})
+	if err != nil {
+		return 0, err
+	}
 	return customer.Id, nil
 }
 
-func (s *service) DeleteById(id uint) error {
-	return s.repo.DeleteById(id)
+// DeleteById soft deletes the customer on behalf of the principal of ctx.
+func (s *service) DeleteById(ctx context.Context, id uint) (err error) {
+	ctx, span := tracer.Start(ctx, "customer.Service.DeleteById", trace.WithAttributes(attribute.Int64("customer.id", int64(id))))
+	defer func() { tracing.End(span, err) }()
+
+	err = s.uow.Do(ctx, func(repo Repository) error {
+		before, err := repo.LockById(ctx, id)
+		if err != nil {
+			return err
+		}
+		if before == nil || before.IsDeleted {
+			return ErrNotFound
+		}
+		if err := repo.DeleteById(ctx, id); err != nil {
+			return err
+		}
+
+		after := *before
+		after.IsDeleted = true
+		return recordChange(ctx, repo, AuditActionDelete, common.PrincipalFromContext(ctx), id, before, &after)
+	})
+	if err != nil {
+		return err
+	}
+	metrics.CustomersDeleted.Inc()
+	return nil
+}
+
+// RestoreById brings back a soft deleted customer on behalf of the principal of ctx.
+func (s *service) RestoreById(ctx context.Context, id uint) (err error) {
+	ctx, span := tracer.Start(ctx, "customer.Service.RestoreById", trace.WithAttributes(attribute.Int64("customer.id", int64(id))))
+	defer func() { tracing.End(span, err) }()
+
+	return s.uow.Do(ctx, func(repo Repository) error {
+		before, err := repo.LockById(ctx, id)
+		if err != nil {
+			return err
+		}
+		if before == nil || !before.IsDeleted {
+			return ErrNotFound
+		}
+		if err := repo.RestoreById(ctx, id); err != nil {
+			return err
+		}
+
+		after := *before
+		after.IsDeleted = false
+		return recordChange(ctx, repo, AuditActionRestore, common.PrincipalFromContext(ctx), id, before, &after)
+	})
+}
+
+// PurgeById removes the customer, deleted or not, for good on behalf of the
+// principal of ctx. Its history is kept.
+func (s *service) PurgeById(ctx context.Context, id uint) (err error) {
+	ctx, span := tracer.Start(ctx, "customer.Service.PurgeById", trace.WithAttributes(attribute.Int64("customer.id", int64(id))))
+	defer func() { tracing.End(span, err) }()
+
+	return s.uow.Do(ctx, func(repo Repository) error {
+		before, err := repo.LockById(ctx, id)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return ErrNotFound
+		}
+		if err := repo.PurgeById(ctx, id); err != nil {
+			return err
+		}
+		return recordChange(ctx, repo, AuditActionPurge, common.PrincipalFromContext(ctx), id, before, nil)
+	})
+}
+
+// FindHistory pages through the changes of a customer, newest first,
+// including customers that were purged since.
+func (s *service) FindHistory(ctx context.Context, id uint, query common.PaginationQuery) (_ CustomerServiceFindHistory, err error) {
+	ctx, span := tracer.Start(ctx, "customer.Service.FindHistory", trace.WithAttributes(attribute.Int64("customer.id", int64(id))))
+	defer func() { tracing.End(span, err) }()
+
+	audits, total, err := s.repo.FindAuditsAndCount(ctx, id, query.Page, query.PerPage)
+	if err != nil {
+		return CustomerServiceFindHistory{}, err
+	}
+	return CustomerServiceFindHistory{Data: audits, TotalItems: total}, nil
 }
 
 func (s *service) TransformCustomerIndex(customer *Customer) CustomerTransformIndexOutput {
@@ -83,10 +237,43 @@ func (s *service) TransformCustomerIndex(customer *Customer) CustomerTransformIn
 	}
 }
 
-func (s *service) FindById(id uint) (*Customer, error) {
-	return s.repo.FindById(id)
+func (s *service) FindById(ctx context.Context, id uint) (_ *Customer, err error) {
+	ctx, span := tracer.Start(ctx, "customer.Service.FindById", trace.WithAttributes(attribute.Int64("customer.id", int64(id))))
+	defer func() { tracing.End(span, err) }()
+
+	return s.repo.FindById(ctx, id)
+}
+
+// FindByIdAsOf returns the customer as it was at asOf, or nil when it did not
+// exist or was deleted then.
+func (s *service) FindByIdAsOf(ctx context.Context, id uint, asOf time.Time) (_ *Customer, err error) {
+	ctx, span := tracer.Start(ctx, "customer.Service.FindByIdAsOf", trace.WithAttributes(attribute.Int64("customer.id", int64(id))))
+	defer func() { tracing.End(span, err) }()
+
+	return s.repo.FindByIdAsOf(ctx, id, asOf)
 }
 
-func (s *service) FindByEmail(email string, excludeId *uint) (*Customer, error) {
-	return s.repo.FindByEmail(email, excludeId)
+func (s *service) FindByEmail(ctx context.Context, email string, excludeId *uint) (_ *Customer, err error) {
+	ctx, span := tracer.Start(ctx, "customer.Service.FindByEmail")
+	defer func() { tracing.End(span, err) }()
+
+	return s.repo.FindByEmail(ctx, email, excludeId)
+}
+
+// NormalizeEmail returns the form in which emails are stored and compared.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// normalizeAndValidate applies the same rules to every caller of the service,
+// not only to requests that went through gin binding.
+func normalizeAndValidate(body *CustomerCreateBody) error {
+	body.NameTh = strings.TrimSpace(body.NameTh)
+	body.NameEn = strings.TrimSpace(body.NameEn)
+	body.Email = NormalizeEmail(body.Email)
+
+	if err := binding.Validator.ValidateStruct(body); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	return nil
 }
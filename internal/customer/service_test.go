@@ -1,72 +1,189 @@
 package customer
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"test-go/common"
+	"test-go/pkg/outbox"
 	"testing"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/stretchr/testify/assert"
 )
 
 type mockRepository struct {
-	mockCreate          func(customer *Customer) error
-	mockFindAllAndCount func(keyword string, page, perPage int) (CustomerServiceFindAllAndCount, error)
-	mockFindById        func(id uint) (*Customer, error)
-	mockUpdateById      func(customer *Customer) error
-	mockDeleteById      func(id uint) error
-	mockFindByEmail     func(email string, excludeId *uint) (*Customer, error)
+	mockCreate          func(ctx context.Context, customer *Customer) error
+	mockFindAllAndCount func(ctx context.Context, keyword string, page, perPage int) (CustomerServiceFindAllAndCount, error)
+	mockFindById        func(ctx context.Context, id uint) (*Customer, error)
+	mockUpdateById      func(ctx context.Context, customer *Customer) error
+	mockDeleteById      func(ctx context.Context, id uint) error
+	mockFindByEmail     func(ctx context.Context, email string, excludeId *uint) (*Customer, error)
+	mockBulkCreate      func(ctx context.Context, customers []Customer) (int64, error)
+	mockFindInBatches   func(ctx context.Context, batchSize int, fn func(batch []Customer) error) error
+	mockLockById        func(ctx context.Context, id uint) (*Customer, error)
+	mockRestoreById     func(ctx context.Context, id uint) error
+	mockPurgeById       func(ctx context.Context, id uint) error
+	mockFindByIdAsOf    func(ctx context.Context, id uint, asOf time.Time) (*Customer, error)
+	mockFindAllAsOf     func(ctx context.Context, keyword string, page, perPage int, asOf time.Time) (CustomerServiceFindAllAndCount, error)
+	// audits collects the audit records created through the mock.
+	audits []CustomerAudit
+	// versions collects the states recorded through the mock, nil for a purge.
+	versions []*Customer
+	// events collects the outbox events recorded through the mock.
+	events []outbox.Event
+	// notified collects the ids of the customers notified as changed.
+	notified []uint
 }
 
-func (m *mockRepository) Create(customer *Customer) error {
+func (m *mockRepository) Create(ctx context.Context, customer *Customer) error {
 	if m.mockCreate != nil {
-		return m.mockCreate(customer)
+		return m.mockCreate(ctx, customer)
 	}
 	return nil
 }
 
-func (m *mockRepository) FindAllAndCount(keyword string, page, perPage int) (CustomerServiceFindAllAndCount, error) {
+func (m *mockRepository) FindAllAndCount(ctx context.Context, keyword string, page, perPage int) (CustomerServiceFindAllAndCount, error) {
 	if m.mockFindAllAndCount != nil {
-		return m.mockFindAllAndCount(keyword, page, perPage)
+		return m.mockFindAllAndCount(ctx, keyword, page, perPage)
 	}
 	return CustomerServiceFindAllAndCount{}, nil
 }
 
-func (m *mockRepository) FindById(id uint) (*Customer, error) {
+func (m *mockRepository) FindById(ctx context.Context, id uint) (*Customer, error) {
 	if m.mockFindById != nil {
-		return m.mockFindById(id)
+		return m.mockFindById(ctx, id)
 	}
 	return nil, nil
 }
 
-func (m *mockRepository) UpdateById(customer *Customer) error {
+func (m *mockRepository) UpdateById(ctx context.Context, customer *Customer) error {
 	if m.mockUpdateById != nil {
-		return m.mockUpdateById(customer)
+		return m.mockUpdateById(ctx, customer)
 	}
 	return nil
 }
 
-func (m *mockRepository) DeleteById(id uint) error {
+func (m *mockRepository) DeleteById(ctx context.Context, id uint) error {
 	if m.mockDeleteById != nil {
-		return m.mockDeleteById(id)
+		return m.mockDeleteById(ctx, id)
 	}
 	return nil
 }
 
-func (m *mockRepository) FindByEmail(email string, excludeId *uint) (*Customer, error) {
+func (m *mockRepository) FindByEmail(ctx context.Context, email string, excludeId *uint) (*Customer, error) {
 	if m.mockFindByEmail != nil {
-		return m.mockFindByEmail(email, excludeId)
+		return m.mockFindByEmail(ctx, email, excludeId)
 	}
 	return nil, nil
 }
 
+func (m *mockRepository) BulkCreate(ctx context.Context, customers []Customer) (int64, error) {
+	if m.mockBulkCreate != nil {
+		return m.mockBulkCreate(ctx, customers)
+	}
+	return int64(len(customers)), nil
+}
+
+func (m *mockRepository) FindInBatches(ctx context.Context, batchSize int, fn func(batch []Customer) error) error {
+	if m.mockFindInBatches != nil {
+		return m.mockFindInBatches(ctx, batchSize, fn)
+	}
+	return nil
+}
+
+func (m *mockRepository) LockById(ctx context.Context, id uint) (*Customer, error) {
+	if m.mockLockById != nil {
+		return m.mockLockById(ctx, id)
+	}
+	return nil, nil
+}
+
+func (m *mockRepository) RestoreById(ctx context.Context, id uint) error {
+	if m.mockRestoreById != nil {
+		return m.mockRestoreById(ctx, id)
+	}
+	return nil
+}
+
+func (m *mockRepository) PurgeById(ctx context.Context, id uint) error {
+	if m.mockPurgeById != nil {
+		return m.mockPurgeById(ctx, id)
+	}
+	return nil
+}
+
+func (m *mockRepository) CreateAudit(ctx context.Context, audit *CustomerAudit) error {
+	m.audits = append(m.audits, *audit)
+	return nil
+}
+
+func (m *mockRepository) FindAuditsAndCount(ctx context.Context, customerId uint, page, perPage int) ([]CustomerAudit, int64, error) {
+	// Newest first, like the repository.
+	var audits []CustomerAudit
+	for i := len(m.audits) - 1; i >= 0; i-- {
+		if m.audits[i].CustomerId == customerId {
+			audits = append(audits, m.audits[i])
+		}
+	}
+	return audits, int64(len(audits)), nil
+}
+
+func (m *mockRepository) RecordVersion(ctx context.Context, customerId uint, state *Customer) error {
+	if state != nil {
+		copied := *state
+		state = &copied
+	}
+	m.versions = append(m.versions, state)
+	return nil
+}
+
+func (m *mockRepository) RecordEvent(ctx context.Context, event *outbox.Event) error {
+	m.events = append(m.events, *event)
+	return nil
+}
+
+func (m *mockRepository) NotifyChanged(ctx context.Context, id uint) error {
+	m.notified = append(m.notified, id)
+	return nil
+}
+
+func (m *mockRepository) FindByIdAsOf(ctx context.Context, id uint, asOf time.Time) (*Customer, error) {
+	if m.mockFindByIdAsOf != nil {
+		return m.mockFindByIdAsOf(ctx, id, asOf)
+	}
+	return nil, nil
+}
+
+func (m *mockRepository) FindAllAndCountAsOf(ctx context.Context, keyword string, page, perPage int, asOf time.Time) (CustomerServiceFindAllAndCount, error) {
+	if m.mockFindAllAsOf != nil {
+		return m.mockFindAllAsOf(ctx, keyword, page, perPage, asOf)
+	}
+	return CustomerServiceFindAllAndCount{}, nil
+}
+
+// mockUnitOfWork runs the closure against repo directly, returning its error
+// as a rolled back transaction would.
+type mockUnitOfWork struct {
+	repo Repository
+	runs int
+}
+
+func (m *mockUnitOfWork) Do(ctx context.Context, fn func(repo Repository) error) error {
+	m.runs++
+	return fn(m.repo)
+}
+
 func TestService_Create(t *testing.T) {
 	mockRepo := &mockRepository{
-		mockCreate: func(c *Customer) error {
+		mockCreate: func(ctx context.Context, c *Customer) error {
 			c.Id = 123
 			return nil
 		},
 	}
 
-	svc := NewService(mockRepo)
+	svc := NewService(mockRepo, &mockUnitOfWork{repo: mockRepo})
 
 	input := &CustomerServiceCreateInput{
 		CustomerCreateBody: CustomerCreateBody{
@@ -77,14 +194,118 @@ func TestService_Create(t *testing.T) {
 		CreatedBy: "unit@test.com",
 	}
 
-	id, err := svc.Create(input)
+	id, err := svc.Create(context.Background(), input)
 	assert.NoError(t, err)
 	assert.Equal(t, uint(123), id)
 }
 
+func TestService_Create_ReturnsEmailConflict(t *testing.T) {
+	mockRepo := &mockRepository{
+		mockCreate: func(ctx context.Context, c *Customer) error {
+			return translateError(&pgconn.PgError{Code: uniqueViolation, ConstraintName: emailUniqueConstraint})
+		},
+	}
+	uow := &mockUnitOfWork{repo: mockRepo}
+
+	_, err := NewService(mockRepo, uow).Create(context.Background(), &CustomerServiceCreateInput{
+		CustomerCreateBody: CustomerCreateBody{NameTh: "ทดสอบ", NameEn: "Test", Email: "taken@example.com"},
+	})
+	assert.ErrorIs(t, err, ErrEmailExists)
+	assert.Equal(t, 1, uow.runs)
+
+	other := &pgconn.PgError{Code: uniqueViolation, ConstraintName: "customers_pkey"}
+	assert.Equal(t, error(other), translateError(other))
+}
+
+func TestService_UpdateById_ReturnsRepositoryError(t *testing.T) {
+	failure := errors.New("update failed")
+	mockRepo := &mockRepository{
+		mockLockById: func(ctx context.Context, id uint) (*Customer, error) {
+			return &Customer{Id: id}, nil
+		},
+		mockUpdateById: func(ctx context.Context, c *Customer) error {
+			return failure
+		},
+	}
+	uow := &mockUnitOfWork{repo: mockRepo}
+
+	_, err := NewService(mockRepo, uow).UpdateById(context.Background(), 3, &CustomerServiceUpdateInput{
+		CustomerCreateBody: CustomerCreateBody{NameTh: "ทดสอบ", NameEn: "Test", Email: "test@example.com"},
+	})
+	assert.ErrorIs(t, err, failure)
+	assert.Equal(t, 1, uow.runs)
+	assert.Empty(t, mockRepo.audits)
+}
+
+func TestService_PassesContextToRepository(t *testing.T) {
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "request")
+
+	var received []context.Context
+	mockRepo := &mockRepository{
+		mockFindById: func(ctx context.Context, id uint) (*Customer, error) {
+			received = append(received, ctx)
+			return nil, nil
+		},
+		mockLockById: func(ctx context.Context, id uint) (*Customer, error) {
+			received = append(received, ctx)
+			return &Customer{Id: id}, nil
+		},
+		mockDeleteById: func(ctx context.Context, id uint) error {
+			received = append(received, ctx)
+			return ctx.Err()
+		},
+	}
+
+	svc := NewService(mockRepo, &mockUnitOfWork{repo: mockRepo})
+
+	_, err := svc.FindById(ctx, 1)
+	assert.NoError(t, err)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	err = svc.DeleteById(canceled, 1)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	assert.Len(t, received, 3)
+	for _, c := range received {
+		assert.Equal(t, "request", c.Value(key{}))
+	}
+}
+
+func TestService_Create_NormalizesAndValidates(t *testing.T) {
+	var created *Customer
+	mockRepo := &mockRepository{
+		mockCreate: func(ctx context.Context, c *Customer) error {
+			created = c
+			return nil
+		},
+	}
+
+	svc := NewService(mockRepo, &mockUnitOfWork{repo: mockRepo})
+
+	_, err := svc.Create(context.Background(), &CustomerServiceCreateInput{
+		CustomerCreateBody: CustomerCreateBody{
+			NameTh: "  ทดสอบ ",
+			NameEn: "Test  ",
+			Email:  " Test@Example.COM",
+		},
+		CreatedBy: "unit@test.com",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "ทดสอบ", created.NameTh)
+	assert.Equal(t, "Test", created.NameEn)
+	assert.Equal(t, "test@example.com", created.Email)
+
+	_, err = svc.Create(context.Background(), &CustomerServiceCreateInput{
+		CustomerCreateBody: CustomerCreateBody{NameTh: "ทดสอบ", NameEn: "Test", Email: "not-an-email"},
+	})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
 func CustomerService_FindAllAndCount(t *testing.T) {
 	mockRepo := &mockRepository{
-		mockFindAllAndCount: func(keyword string, page, perPage int) (CustomerServiceFindAllAndCount, error) {
+		mockFindAllAndCount: func(ctx context.Context, keyword string, page, perPage int) (CustomerServiceFindAllAndCount, error) {
 			return CustomerServiceFindAllAndCount{
 				TotalItems: 1,
 				Data: []Customer{
@@ -94,7 +315,7 @@ func CustomerService_FindAllAndCount(t *testing.T) {
 		},
 	}
 
-	svc := NewService(mockRepo)
+	svc := NewService(mockRepo, &mockUnitOfWork{repo: mockRepo})
 
 	keyword := "test"
 	filter := CustomerIndexQuery{
@@ -105,7 +326,7 @@ func CustomerService_FindAllAndCount(t *testing.T) {
 		},
 	}
 
-	result, err := svc.FindAllAndCount(filter)
+	result, err := svc.FindAllAndCount(context.Background(), filter)
 	assert.NoError(t, err)
 	assert.Equal(t, int64(1), result.TotalItems)
 
@@ -116,7 +337,10 @@ func CustomerService_FindAllAndCount(t *testing.T) {
 func CustomerService_UpdateById(t *testing.T) {
 	updated := false
 	mockRepo := &mockRepository{
-		mockUpdateById: func(c *Customer) error {
+		mockLockById: func(ctx context.Context, id uint) (*Customer, error) {
+			return &Customer{Id: id}, nil
+		},
+		mockUpdateById: func(ctx context.Context, c *Customer) error {
 			updated = true
 			assert.Equal(t, uint(1), c.Id)
 			assert.Equal(t, "Updated Name", c.NameTh)
@@ -124,7 +348,7 @@ func CustomerService_UpdateById(t *testing.T) {
 		},
 	}
 
-	svc := NewService(mockRepo)
+	svc := NewService(mockRepo, &mockUnitOfWork{repo: mockRepo})
 
 	input := &CustomerServiceUpdateInput{
 		CustomerCreateBody: CustomerCreateBody{
@@ -135,7 +359,7 @@ func CustomerService_UpdateById(t *testing.T) {
 		UpdatedBy: "unit@test.com",
 	}
 
-	id, err := svc.UpdateById(1, input)
+	id, err := svc.UpdateById(context.Background(), 1, input)
 	assert.NoError(t, err)
 	assert.Equal(t, uint(1), id)
 	assert.True(t, updated)
@@ -144,30 +368,33 @@ func CustomerService_UpdateById(t *testing.T) {
 func CustomerService_DeleteById(t *testing.T) {
 	deleted := false
 	mockRepo := &mockRepository{
-		mockDeleteById: func(id uint) error {
+		mockLockById: func(ctx context.Context, id uint) (*Customer, error) {
+			return &Customer{Id: id}, nil
+		},
+		mockDeleteById: func(ctx context.Context, id uint) error {
 			deleted = true
 			assert.Equal(t, uint(1), id)
 			return nil
 		},
 	}
 
-	svc := NewService(mockRepo)
+	svc := NewService(mockRepo, &mockUnitOfWork{repo: mockRepo})
 
-	err := svc.DeleteById(1)
+	err := svc.DeleteById(context.Background(), 1)
 	assert.NoError(t, err)
 	assert.True(t, deleted)
 }
 
 func CustomerService_FindById(t *testing.T) {
 	mockRepo := &mockRepository{
-		mockFindById: func(id uint) (*Customer, error) {
+		mockFindById: func(ctx context.Context, id uint) (*Customer, error) {
 			return &Customer{Id: id, Email: "findbyid@example.com"}, nil
 		},
 	}
 
-	svc := NewService(mockRepo)
+	svc := NewService(mockRepo, &mockUnitOfWork{repo: mockRepo})
 
-	cust, err := svc.FindById(1)
+	cust, err := svc.FindById(context.Background(), 1)
 	assert.NoError(t, err)
 	assert.NotNil(t, cust)
 	assert.Equal(t, "findbyid@example.com", cust.Email)
@@ -175,7 +402,7 @@ func CustomerService_FindById(t *testing.T) {
 
 func CustomerService_FindByEmail(t *testing.T) {
 	mockRepo := &mockRepository{
-		mockFindByEmail: func(email string, excludeId *uint) (*Customer, error) {
+		mockFindByEmail: func(ctx context.Context, email string, excludeId *uint) (*Customer, error) {
 			if email == "exists@example.com" {
 				return &Customer{Id: 1, Email: email}, nil
 			}
@@ -183,14 +410,142 @@ func CustomerService_FindByEmail(t *testing.T) {
 		},
 	}
 
-	svc := NewService(mockRepo)
+	svc := NewService(mockRepo, &mockUnitOfWork{repo: mockRepo})
 
-	cust, err := svc.FindByEmail("exists@example.com", nil)
+	cust, err := svc.FindByEmail(context.Background(), "exists@example.com", nil)
 	assert.NoError(t, err)
 	assert.NotNil(t, cust)
 	assert.Equal(t, "exists@example.com", cust.Email)
 
-	cust, err = svc.FindByEmail("notfound@example.com", nil)
+	cust, err = svc.FindByEmail(context.Background(), "notfound@example.com", nil)
 	assert.NoError(t, err)
 	assert.Nil(t, cust)
 }
+
+func TestService_RecordsAuditOfEveryChange(t *testing.T) {
+	stored := &Customer{Id: 5, NameTh: "สมชาย", NameEn: "Somchai", Email: "old@example.com"}
+	mockRepo := &mockRepository{
+		mockCreate: func(ctx context.Context, c *Customer) error {
+			c.Id = 5
+			return nil
+		},
+		mockLockById: func(ctx context.Context, id uint) (*Customer, error) {
+			current := *stored
+			return &current, nil
+		},
+	}
+	svc := NewService(mockRepo, &mockUnitOfWork{repo: mockRepo})
+	ctx := common.WithPrincipal(context.Background(), "admin@example.com")
+
+	_, err := svc.Create(ctx, &CustomerServiceCreateInput{
+		CustomerCreateBody: CustomerCreateBody{NameTh: "สมชาย", NameEn: "Somchai", Email: "old@example.com"},
+		CreatedBy:          "creator@example.com",
+	})
+	assert.NoError(t, err)
+
+	_, err = svc.UpdateById(ctx, 5, &CustomerServiceUpdateInput{
+		CustomerCreateBody: CustomerCreateBody{NameTh: "สมชาย", NameEn: "Somchai", Email: "new@example.com"},
+		UpdatedBy:          "editor@example.com",
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, svc.DeleteById(ctx, 5))
+	stored.IsDeleted = true
+	assert.NoError(t, svc.RestoreById(ctx, 5))
+	assert.NoError(t, svc.PurgeById(ctx, 5))
+
+	history, err := svc.FindHistory(ctx, 5, common.PaginationQuery{Page: 1, PerPage: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), history.TotalItems)
+
+	expected := []struct {
+		action, actor, changes string
+	}{
+		{AuditActionPurge, "admin@example.com", `{"email":{"before":"old@example.com","after":null},"is_deleted":{"before":true,"after":null},"name_en":{"before":"Somchai","after":null},"name_th":{"before":"สมชาย","after":null}}`},
+		{AuditActionRestore, "admin@example.com", `{"is_deleted":{"before":true,"after":false}}`},
+		{AuditActionDelete, "admin@example.com", `{"is_deleted":{"before":false,"after":true}}`},
+		{AuditActionUpdate, "editor@example.com", `{"email":{"before":"old@example.com","after":"new@example.com"}}`},
+		{AuditActionCreate, "creator@example.com", `{"email":{"before":null,"after":"old@example.com"},"is_deleted":{"before":null,"after":false},"name_en":{"before":null,"after":"Somchai"},"name_th":{"before":null,"after":"สมชาย"}}`},
+	}
+	assert.Len(t, history.Data, len(expected))
+	for i, audit := range history.Data {
+		assert.Equal(t, uint(5), audit.CustomerId)
+		assert.Equal(t, expected[i].action, audit.Action)
+		assert.Equal(t, expected[i].actor, audit.Actor)
+		assert.JSONEq(t, expected[i].changes, string(audit.Changes))
+	}
+
+	assert.Len(t, mockRepo.versions, 5)
+	assert.Equal(t, "old@example.com", mockRepo.versions[0].Email)
+	assert.Equal(t, "new@example.com", mockRepo.versions[1].Email)
+	assert.True(t, mockRepo.versions[2].IsDeleted)
+	assert.False(t, mockRepo.versions[3].IsDeleted)
+	assert.Nil(t, mockRepo.versions[4])
+
+	assert.Equal(t, []uint{5, 5, 5, 5, 5}, mockRepo.notified)
+
+	var eventTypes []string
+	for _, event := range mockRepo.events {
+		assert.Equal(t, "5", event.AggregateId)
+		eventTypes = append(eventTypes, event.Type)
+	}
+	assert.Equal(t, []string{EventCustomerCreated, EventCustomerUpdated, EventCustomerDeleted, EventCustomerRestored, EventCustomerPurged}, eventTypes)
+
+	var updated CustomerEvent
+	assert.NoError(t, json.Unmarshal(mockRepo.events[1].Payload, &updated))
+	assert.Equal(t, "new@example.com", updated.Customer.Email)
+	var purged CustomerEvent
+	assert.NoError(t, json.Unmarshal(mockRepo.events[4].Payload, &purged))
+	assert.Nil(t, purged.Customer)
+}
+
+func TestService_ReadsAsOf(t *testing.T) {
+	asOf := time.Date(2025, 1, 31, 10, 0, 0, 0, time.UTC)
+	mockRepo := &mockRepository{
+		mockFindAllAndCount: func(ctx context.Context, keyword string, page, perPage int) (CustomerServiceFindAllAndCount, error) {
+			t.Fatal("current state read for an asOf listing")
+			return CustomerServiceFindAllAndCount{}, nil
+		},
+		mockFindAllAsOf: func(ctx context.Context, keyword string, page, perPage int, at time.Time) (CustomerServiceFindAllAndCount, error) {
+			assert.Equal(t, asOf, at)
+			assert.Equal(t, "som", keyword)
+			return CustomerServiceFindAllAndCount{TotalItems: 1, Data: []Customer{{Id: 1}}}, nil
+		},
+		mockFindByIdAsOf: func(ctx context.Context, id uint, at time.Time) (*Customer, error) {
+			assert.Equal(t, asOf, at)
+			return &Customer{Id: id, Email: "then@example.com"}, nil
+		},
+	}
+	svc := NewService(mockRepo, &mockUnitOfWork{repo: mockRepo})
+
+	keyword := "som"
+	result, err := svc.FindAllAndCount(context.Background(), CustomerIndexQuery{
+		PaginationQuery: common.PaginationQuery{Page: 1, PerPage: 10},
+		Keyword:         &keyword,
+		AsOf:            &asOf,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), result.TotalItems)
+
+	customer, err := svc.FindByIdAsOf(context.Background(), 1, asOf)
+	assert.NoError(t, err)
+	assert.Equal(t, "then@example.com", customer.Email)
+}
+
+func TestService_RestoreById_OnlyRestoresDeletedCustomers(t *testing.T) {
+	restored := false
+	mockRepo := &mockRepository{
+		mockLockById: func(ctx context.Context, id uint) (*Customer, error) {
+			return &Customer{Id: id}, nil
+		},
+		mockRestoreById: func(ctx context.Context, id uint) error {
+			restored = true
+			return nil
+		},
+	}
+
+	err := NewService(mockRepo, &mockUnitOfWork{repo: mockRepo}).RestoreById(context.Background(), 1)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.False(t, restored)
+	assert.Empty(t, mockRepo.audits)
+}
@@ -0,0 +1,182 @@
+package customer
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"test-go/common"
+	"test-go/pkg/logging"
+	"test-go/pkg/outbox"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+// streamBacklogPage bounds the events read at once when a stream resumes.
+const streamBacklogPage = 500
+
+// StreamHandler serves the customer events of the outbox as Server-Sent Events.
+type StreamHandler struct {
+	Tail      *outbox.Tail
+	Heartbeat time.Duration
+	// CanReceive decides, for each connection, whether its principal may
+	// receive event. Without it no event is sent.
+	CanReceive func(principal string, event outbox.Event) bool
+}
+
+// NewStreamHandler returns a handler sending each connection the events
+// canReceive lets its principal receive.
+func NewStreamHandler(tail *outbox.Tail, heartbeat time.Duration, canReceive func(principal string, event outbox.Event) bool) *StreamHandler {
+	return &StreamHandler{Tail: tail, Heartbeat: heartbeat, CanReceive: canReceive}
+}
+
+// AllowAuthenticated lets every authenticated principal receive every event.
+// It is only fit while every principal may read every customer, as with the
+// mock authentication; a deployment with permissions passes its own check to
+// NewStreamHandler.
+func AllowAuthenticated(principal string, event outbox.Event) bool {
+	return principal != ""
+}
+
+// receives reports whether the connection of principal, asking for types,
+// is sent event.
+func (h *StreamHandler) receives(principal string, types map[string]struct{}, event outbox.Event) bool {
+	_, ok := types[event.Type]
+	return ok && h.CanReceive != nil && h.CanReceive(principal, event)
+}
+
+// @Tags Customers
+// @Summary Stream customer changes
+// @Description Server-Sent Events of customer changes. Each event carries the outbox event id, the event type (CustomerCreated, CustomerUpdated, CustomerDeleted, CustomerRestored or CustomerPurged) and the change as data. A reconnecting client sending Last-Event-ID first receives the events it missed; an id the outbox does not hold resumes from the latest event, like a new connection. Comments are sent as heartbeats while nothing changes.
+// @Produce text/event-stream
+// @Param Last-Event-ID header int false "Resume after this event id"
+// @Param types query string false "Comma separated event types to receive, every type when empty"
+// @Success 200 {string} string "Event stream"
+// @Failure 400 {object} common.ResponseError
+// @Failure 503 {object} common.ResponseError
+// @Router /customers/events [get]
+func (h *StreamHandler) Events(c *gin.Context) {
+	types, err := parseEventTypes(c.Query("types"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, common.ResponseError{Error: err.Error()})
+		return
+	}
+	var last outbox.Position
+	resume := c.GetHeader("Last-Event-ID") != ""
+	if resume {
+		lastId, err := strconv.ParseUint(c.GetHeader("Last-Event-ID"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, common.ResponseError{Error: "invalid Last-Event-ID"})
+			return
+		}
+		last, err = h.Tail.PositionOf(c.Request.Context(), lastId)
+		if errors.Is(err, outbox.ErrUnknownEvent) {
+			last, err = h.Tail.Latest(c.Request.Context())
+		}
+		if err != nil {
+			common.InternalError(c, err)
+			return
+		}
+	}
+
+	// subscribe before reading the missed events, so none falls in between
+	sub := h.Tail.Subscribe()
+	if sub == nil {
+		c.JSON(http.StatusServiceUnavailable, common.ResponseError{Error: "server is shutting down"})
+		return
+	}
+	defer sub.Close()
+
+	ctx := c.Request.Context()
+	logger := logging.FromContext(ctx)
+	// the stream outlives the server write timeout
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		logger.Warn("failed to lift the write deadline of the event stream", "error", err)
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	principal := common.Principal(c)
+	send := func(event outbox.Event) {
+		// events read as missed can arrive again through the subscription
+		if !last.Less(event.Position()) {
+			return
+		}
+		last = event.Position()
+		if !h.receives(principal, types, event) {
+			return
+		}
+		c.Render(-1, sse.Event{Id: strconv.FormatUint(event.Id, 10), Event: event.Type, Data: string(event.Payload)})
+	}
+
+	if resume {
+		for {
+			events, err := h.Tail.Since(ctx, last, streamBacklogPage)
+			if err != nil {
+				logger.ErrorContext(ctx, "failed to read missed customer events", "error", err)
+				return
+			}
+			for _, event := range events {
+				send(event)
+			}
+			c.Writer.Flush()
+			if len(events) < streamBacklogPage {
+				break
+			}
+		}
+	}
+
+	heartbeat := time.NewTicker(h.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-sub.Events():
+			if !ok {
+				// fell behind or shutting down: the client reconnects with Last-Event-ID
+				return
+			}
+			send(event)
+		case <-heartbeat.C:
+			c.Writer.WriteString(": heartbeat\n\n")
+		}
+		c.Writer.Flush()
+	}
+}
+
+// parseEventTypes returns the customer event types listed in query, or every
+// customer event type when it is empty.
+func parseEventTypes(query string) (map[string]struct{}, error) {
+	known := make(map[string]struct{}, len(eventTypes))
+	for _, eventType := range eventTypes {
+		known[eventType] = struct{}{}
+	}
+	if strings.TrimSpace(query) == "" {
+		return known, nil
+	}
+
+	types := map[string]struct{}{}
+	for _, eventType := range strings.Split(query, ",") {
+		eventType = strings.TrimSpace(eventType)
+		if _, ok := known[eventType]; !ok {
+			return nil, fmt.Errorf("unknown event type %q", eventType)
+		}
+		types[eventType] = struct{}{}
+	}
+	return types, nil
+}
+
+// RegisterRoutes adds the stream to rg, which must not bound the request
+// duration like the other customer routes.
+func (h *StreamHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/customers/events", h.Events)
+}
@@ -0,0 +1,44 @@
+package customer
+
+import (
+	"test-go/pkg/outbox"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamHandler_SendsOnlyWhatThePrincipalMayReceive(t *testing.T) {
+	types := map[string]struct{}{EventCustomerCreated: {}, EventCustomerUpdated: {}}
+	handler := NewStreamHandler(nil, 0, func(principal string, event outbox.Event) bool {
+		return principal == "admin@example.com" || event.AggregateId == "1"
+	})
+
+	assert.True(t, handler.receives("admin@example.com", types, outbox.Event{Type: EventCustomerCreated, AggregateId: "2"}))
+	assert.True(t, handler.receives("unit@test.com", types, outbox.Event{Type: EventCustomerUpdated, AggregateId: "1"}))
+	assert.False(t, handler.receives("unit@test.com", types, outbox.Event{Type: EventCustomerUpdated, AggregateId: "2"}), "the principal may not receive the event")
+	assert.False(t, handler.receives("admin@example.com", types, outbox.Event{Type: EventCustomerDeleted, AggregateId: "2"}), "the type was not asked for")
+
+	handler.CanReceive = nil
+	assert.False(t, handler.receives("admin@example.com", types, outbox.Event{Type: EventCustomerCreated, AggregateId: "2"}), "nothing is sent without a check")
+}
+
+func TestAllowAuthenticated(t *testing.T) {
+	assert.True(t, AllowAuthenticated("unit@test.com", outbox.Event{}))
+	assert.False(t, AllowAuthenticated("", outbox.Event{}))
+}
+
+func TestParseEventTypes(t *testing.T) {
+	types, err := parseEventTypes("")
+	assert.NoError(t, err)
+	assert.Len(t, types, len(eventTypes), "every type when none is listed")
+
+	types, err = parseEventTypes(" CustomerCreated, CustomerDeleted ,CustomerCreated")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]struct{}{EventCustomerCreated: {}, EventCustomerDeleted: {}}, types)
+
+	_, err = parseEventTypes("CustomerCreated,CustomerMoved")
+	assert.EqualError(t, err, `unknown event type "CustomerMoved"`)
+
+	_, err = parseEventTypes("CustomerCreated,")
+	assert.EqualError(t, err, `unknown event type ""`)
+}
@@ -1,7 +1,9 @@
 package customer
 
 import (
+	"fmt"
 	"test-go/common"
+	"test-go/pkg/logging"
 	"time"
 )
 
@@ -20,6 +22,11 @@ type CustomerCreateBody struct {
 	Email  string `json:"email" binding:"required,email" example:"somchai@example.com"`
 }
 
+// String masks the names and the email, like Customer.String.
+func (b CustomerCreateBody) String() string {
+	return fmt.Sprintf("{NameTh:%s NameEn:%s Email:%s}", logging.MaskName(b.NameTh), logging.MaskName(b.NameEn), logging.MaskEmail(b.Email))
+}
+
 type CustomerServiceCreateInput struct {
 	CustomerCreateBody
 	CreatedBy string
@@ -28,6 +35,13 @@ type CustomerServiceCreateInput struct {
 type CustomerIndexQuery struct {
 	common.PaginationQuery
 	Keyword *string `form:"keyword" example:"search term"`
+	// AsOf lists the customers as they were at that instant.
+	AsOf *time.Time `form:"asOf" time_format:"2006-01-02T15:04:05Z07:00" example:"2025-01-31T17:00:00+07:00"`
+}
+
+type CustomerShowQuery struct {
+	// AsOf returns the customer as it was at that instant.
+	AsOf *time.Time `form:"asOf" time_format:"2006-01-02T15:04:05Z07:00" example:"2025-01-31T17:00:00+07:00"`
 }
 
 type CustomerTransformIndexOutput struct {
@@ -54,3 +68,21 @@ type CustomerServiceUpdateInput struct {
 	CustomerCreateBody
 	UpdatedBy string
 }
+
+type CustomerHistoryQuery struct {
+	common.PaginationQuery
+}
+
+type CustomerServiceFindHistory struct {
+	Data       []CustomerAudit
+	TotalItems int64
+}
+
+type CustomerHistoryResponse struct {
+	Id        uint64                 `json:"id"`
+	Action    string                 `json:"action" example:"update"`
+	Actor     string                 `json:"actor" example:"email@mock.com"`
+	RequestId string                 `json:"requestId"`
+	Changes   map[string]AuditChange `json:"changes"`
+	CreatedAt time.Time              `json:"createdAt"`
+}
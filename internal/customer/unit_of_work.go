@@ -0,0 +1,37 @@
+package customer
+
+import (
+	"context"
+	"test-go/pkg/tracing"
+
+	"gorm.io/gorm"
+)
+
+// UnitOfWork runs a group of repository calls atomically.
+type UnitOfWork interface {
+	// Do runs fn inside one transaction. The repository given to fn is bound
+	// to the transaction, which commits when fn returns nil and rolls back
+	// when it returns an error or panics.
+	Do(ctx context.Context, fn func(repo Repository) error) error
+}
+
+type unitOfWork struct {
+	db            *gorm.DB
+	newRepository func(db *gorm.DB) Repository
+}
+
+// NewUnitOfWork builds transaction scoped repositories with newRepository,
+// usually NewRepository, so decorated repositories keep their behavior inside
+// transactions.
+func NewUnitOfWork(db *gorm.DB, newRepository func(db *gorm.DB) Repository) UnitOfWork {
+	return &unitOfWork{db: db, newRepository: newRepository}
+}
+
+func (u *unitOfWork) Do(ctx context.Context, fn func(repo Repository) error) (err error) {
+	ctx, span := tracer.Start(ctx, "customer.UnitOfWork.Do")
+	defer func() { tracing.End(span, err) }()
+
+	return u.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(u.newRepository(tx))
+	})
+}
@@ -0,0 +1,90 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	database "test-go/pkg/db"
+
+	"gorm.io/gorm"
+)
+
+// Checker is one dependency that has to be available for the service to be ready.
+type Checker interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+type databaseChecker struct {
+	db *gorm.DB
+}
+
+// NewDatabaseChecker pings the database pool.
+func NewDatabaseChecker(db *gorm.DB) Checker {
+	return &databaseChecker{db: db}
+}
+
+func (c *databaseChecker) Name() string {
+	return "database"
+}
+
+func (c *databaseChecker) Check(ctx context.Context) error {
+	sqlDB, err := c.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+type migrationChecker struct {
+	db       *gorm.DB
+	expected uint64
+}
+
+// NewMigrationChecker fails while the database is behind the latest migration
+// version the binary was built with. It reads the version from the primary,
+// which migrations are applied to before the replicas replay them.
+func NewMigrationChecker(db *gorm.DB, expected uint64) Checker {
+	return &migrationChecker{db: db, expected: expected}
+}
+
+func (c *migrationChecker) Name() string {
+	return "migrations"
+}
+
+func (c *migrationChecker) Check(ctx context.Context) error {
+	var version uint64
+	err := c.db.WithContext(database.ReadPrimary(ctx)).Raw(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version).Error
+	if err != nil {
+		return err
+	}
+	if version < c.expected {
+		return fmt.Errorf("database is at version %d, expected %d", version, c.expected)
+	}
+	return nil
+}
+
+type diskChecker struct {
+	path         string
+	minFreeBytes uint64
+}
+
+// NewDiskChecker fails when the file system holding path has less than
+// minFreeBytes available.
+func NewDiskChecker(path string, minFreeBytes uint64) Checker {
+	return &diskChecker{path: path, minFreeBytes: minFreeBytes}
+}
+
+func (c *diskChecker) Name() string {
+	return "disk"
+}
+
+func (c *diskChecker) Check(ctx context.Context) error {
+	free, err := freeBytes(c.path)
+	if err != nil {
+		return err
+	}
+	if free < c.minFreeBytes {
+		return fmt.Errorf("%s has %d bytes free, need at least %d", c.path, free, c.minFreeBytes)
+	}
+	return nil
+}
@@ -2,15 +2,23 @@ package healthcheck
 
 import (
 	"net/http"
+	"test-go/common"
+	database "test-go/pkg/db"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type Handler struct {
+	db       *gorm.DB
+	probes   *Probes
+	replicas *database.Replicas
 }
 
-func NewHandler() *Handler {
-	return &Handler{}
+// NewHandler serves the health of db and of its read replicas, which is nil
+// when it has none.
+func NewHandler(db *gorm.DB, probes *Probes, replicas *database.Replicas) *Handler {
+	return &Handler{db: db, probes: probes, replicas: replicas}
 }
 
 // HealthHandler godoc
@@ -24,8 +32,97 @@ func (h *Handler) HealthCheckHandler(c *gin.Context) {
 	c.String(http.StatusOK, "OK")
 }
 
+// DBStatsHandler godoc
+// @Summary      Database pool statistics
+// @Description  Returns the statistics of the database connection pool for monitoring
+// @Tags         Health
+// @Produce      json
+// @Success      200 {object} DBStatsResponse
+// @Failure      500 {object} common.ResponseError
+// @Router       /health-check/db-stats [get]
+func (h *Handler) DBStatsHandler(c *gin.Context) {
+	sqlDB, err := h.db.DB()
+	if err != nil {
+		common.InternalError(c, err)
+		return
+	}
+
+	stats := sqlDB.Stats()
+	c.JSON(http.StatusOK, DBStatsResponse{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDurationMs:     stats.WaitDuration.Milliseconds(),
+		MaxIdleClosed:      stats.MaxIdleClosed,
+		MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+	})
+}
+
+// ReplicasHandler godoc
+// @Summary      Read replica status
+// @Description  Returns the lag of every read replica at its last check. Reads go to the primary while no replica is healthy, so unhealthy replicas do not fail readiness.
+// @Tags         Health
+// @Produce      json
+// @Success      200 {object} ReplicasResponse
+// @Router       /health-check/replicas [get]
+func (h *Handler) ReplicasHandler(c *gin.Context) {
+	response := ReplicasResponse{Replicas: []ReplicaStatus{}}
+	if h.replicas != nil {
+		for _, status := range h.replicas.Status() {
+			replica := ReplicaStatus{
+				Name:      status.Name,
+				Healthy:   status.Healthy,
+				LagMs:     status.Lag.Milliseconds(),
+				CheckedAt: status.CheckedAt,
+			}
+			if status.Err != nil {
+				replica.Error = status.Err.Error()
+			}
+			response.Replicas = append(response.Replicas, replica)
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// LiveHandler godoc
+// @Summary      Liveness probe
+// @Description  Returns ok while the process is able to serve requests, without checking dependencies
+// @Tags         Health
+// @Produce      json
+// @Success      200 {object} ProbeResponse
+// @Router       /health/live [get]
+func (h *Handler) LiveHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, ProbeResponse{Status: StatusOK, Checks: []CheckResult{}})
+}
+
+// ReadyHandler godoc
+// @Summary      Readiness probe
+// @Description  Checks every dependency and reports the status and latency of each check
+// @Tags         Health
+// @Produce      json
+// @Success      200 {object} ProbeResponse
+// @Failure      503 {object} ProbeResponse
+// @Router       /health/ready [get]
+func (h *Handler) ReadyHandler(c *gin.Context) {
+	response := h.probes.Ready(c.Request.Context())
+	if response.Status != StatusOK {
+		c.JSON(http.StatusServiceUnavailable, response)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
 func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
 	healthCheck := rg.Group("/health-check")
 
 	healthCheck.GET("/", h.HealthCheckHandler)
+	healthCheck.GET("/db-stats", h.DBStatsHandler)
+	healthCheck.GET("/replicas", h.ReplicasHandler)
+
+	health := rg.Group("/health")
+	health.GET("/live", h.LiveHandler)
+	health.GET("/ready", h.ReadyHandler)
 }
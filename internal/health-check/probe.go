@@ -0,0 +1,74 @@
+package healthcheck
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK           = "ok"
+	StatusFail         = "fail"
+	StatusShuttingDown = "shutting_down"
+)
+
+// Probes runs the readiness checks. Readiness fails as soon as the server
+// starts shutting down, so load balancers stop routing new requests to it.
+type Probes struct {
+	checkers     []Checker
+	timeout      time.Duration
+	shuttingDown atomic.Bool
+}
+
+func NewProbes(timeout time.Duration, checkers ...Checker) *Probes {
+	return &Probes{checkers: checkers, timeout: timeout}
+}
+
+func (p *Probes) SetShuttingDown() {
+	p.shuttingDown.Store(true)
+}
+
+// Ready runs every checker concurrently, each bounded by the probe timeout.
+func (p *Probes) Ready(ctx context.Context) ProbeResponse {
+	if p.shuttingDown.Load() {
+		return ProbeResponse{Status: StatusShuttingDown, Checks: []CheckResult{}}
+	}
+
+	results := make([]CheckResult, len(p.checkers))
+	var wg sync.WaitGroup
+	for i, checker := range p.checkers {
+		wg.Add(1)
+		go func(i int, checker Checker) {
+			defer wg.Done()
+			results[i] = p.run(ctx, checker)
+		}(i, checker)
+	}
+	wg.Wait()
+
+	response := ProbeResponse{Status: StatusOK, Checks: results}
+	for _, result := range results {
+		if result.Status != StatusOK {
+			response.Status = StatusFail
+		}
+	}
+	return response
+}
+
+func (p *Probes) run(ctx context.Context, checker Checker) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := checker.Check(ctx)
+	result := CheckResult{
+		Name:      checker.Name(),
+		Status:    StatusOK,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
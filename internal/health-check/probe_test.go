@@ -0,0 +1,71 @@
+package healthcheck
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeChecker struct {
+	name string
+	err  error
+	wait time.Duration
+}
+
+func (f *fakeChecker) Name() string { return f.name }
+
+func (f *fakeChecker) Check(ctx context.Context) error {
+	select {
+	case <-time.After(f.wait):
+		return f.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestProbes_Ready(t *testing.T) {
+	probes := NewProbes(50*time.Millisecond,
+		&fakeChecker{name: "database"},
+		&fakeChecker{name: "migrations", err: errors.New("database is at version 1, expected 2")},
+		&fakeChecker{name: "slow", wait: time.Second},
+	)
+
+	response := probes.Ready(context.Background())
+	assert.Equal(t, StatusFail, response.Status)
+	assert.Len(t, response.Checks, 3)
+	assert.Equal(t, StatusOK, response.Checks[0].Status)
+	assert.Equal(t, "database is at version 1, expected 2", response.Checks[1].Error)
+	assert.Equal(t, context.DeadlineExceeded.Error(), response.Checks[2].Error)
+}
+
+func TestReadyHandler_FailsWhileShuttingDown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	probes := NewProbes(time.Second, &fakeChecker{name: "database"})
+	router := gin.New()
+	NewHandler(nil, probes, nil).RegisterRoutes(router.Group("/"))
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	probes.SetShuttingDown()
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+	var response ProbeResponse
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, StatusShuttingDown, response.Status)
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health/live", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
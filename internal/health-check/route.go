@@ -1,12 +1,14 @@
 package healthcheck
 
 import (
+	database "test-go/pkg/db"
+
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-func RegisterRoutes(rg *gin.RouterGroup, db *gorm.DB) {
+func RegisterRoutes(rg *gin.RouterGroup, db *gorm.DB, probes *Probes, replicas *database.Replicas) {
 
-	handler := NewHandler()
+	handler := NewHandler(db, probes, replicas)
 	handler.RegisterRoutes(rg)
 }
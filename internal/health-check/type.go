@@ -0,0 +1,39 @@
+package healthcheck
+
+import "time"
+
+type DBStatsResponse struct {
+	MaxOpenConnections int   `json:"maxOpenConnections"`
+	OpenConnections    int   `json:"openConnections"`
+	InUse              int   `json:"inUse"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"waitCount"`
+	WaitDurationMs     int64 `json:"waitDurationMs"`
+	MaxIdleClosed      int64 `json:"maxIdleClosed"`
+	MaxIdleTimeClosed  int64 `json:"maxIdleTimeClosed"`
+	MaxLifetimeClosed  int64 `json:"maxLifetimeClosed"`
+}
+
+type ReplicaStatus struct {
+	Name      string    `json:"name" example:"replica-1:5432"`
+	Healthy   bool      `json:"healthy" example:"true"`
+	LagMs     int64     `json:"lagMs" example:"120"`
+	CheckedAt time.Time `json:"checkedAt"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type ReplicasResponse struct {
+	Replicas []ReplicaStatus `json:"replicas"`
+}
+
+type CheckResult struct {
+	Name      string  `json:"name" example:"database"`
+	Status    string  `json:"status" example:"ok"`
+	LatencyMs float64 `json:"latencyMs" example:"1.25"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type ProbeResponse struct {
+	Status string        `json:"status" example:"ok"`
+	Checks []CheckResult `json:"checks"`
+}
@@ -0,0 +1,50 @@
+package seed
+
+import (
+	"context"
+	"errors"
+	"test-go/internal/customer"
+)
+
+type customerFixture struct {
+	customer.CustomerCreateBody
+	CreatedBy string `json:"createdBy"`
+}
+
+const defaultSeedUser = "seed@system"
+
+// CustomerLoader creates the fixture customers through the service, so they
+// are normalized and validated like API input. Customers whose email already
+// exists are skipped.
+func CustomerLoader(ctx context.Context, service customer.Service) Loader {
+	return func(decode DecodeFunc) (Result, error) {
+		var result Result
+
+		var fixtures []customerFixture
+		if err := decode(&fixtures); err != nil {
+			return result, err
+		}
+
+		for _, fixture := range fixtures {
+			createdBy := fixture.CreatedBy
+			if createdBy == "" {
+				createdBy = defaultSeedUser
+			}
+
+			_, err := service.Create(ctx, &customer.CustomerServiceCreateInput{
+				CustomerCreateBody: fixture.CustomerCreateBody,
+				CreatedBy:          createdBy,
+			})
+			if errors.Is(err, customer.ErrEmailExists) {
+				result.Skipped++
+				continue
+			}
+			if err != nil {
+				return result, err
+			}
+			result.Created++
+		}
+
+		return result, nil
+	}
+}
@@ -0,0 +1,49 @@
+package seed
+
+import (
+	"context"
+	"test-go/internal/customer"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// customerStore stands in for the customer service, rejecting emails it
+// already has like the unique constraint does.
+type customerStore struct {
+	customer.Service
+	createdBy map[string]string
+}
+
+func (s *customerStore) Create(ctx context.Context, input *customer.CustomerServiceCreateInput) (uint, error) {
+	email := customer.NormalizeEmail(input.Email)
+	if _, ok := s.createdBy[email]; ok {
+		return 0, customer.ErrEmailExists
+	}
+	s.createdBy[email] = input.CreatedBy
+	return uint(len(s.createdBy)), nil
+}
+
+func TestCustomerLoader_SkipsExistingEmailsOnTheNextRun(t *testing.T) {
+	fixtures := []byte(`
+- nameTh: แอน
+  nameEn: Ann
+  email: ann@example.com
+- nameTh: บ๊อบ
+  nameEn: Bob
+  email: bob@example.com
+  createdBy: admin@example.com
+`)
+	store := &customerStore{createdBy: map[string]string{}}
+	load := CustomerLoader(context.Background(), store)
+
+	result, err := load(decoder("customers.yaml", fixtures))
+	assert.NoError(t, err)
+	assert.Equal(t, Result{Created: 2}, result)
+	assert.Equal(t, map[string]string{"ann@example.com": defaultSeedUser, "bob@example.com": "admin@example.com"}, store.createdBy)
+
+	result, err = load(decoder("customers.yaml", fixtures))
+	assert.NoError(t, err)
+	assert.Equal(t, Result{Skipped: 2}, result)
+	assert.Len(t, store.createdBy, 2)
+}
@@ -0,0 +1,105 @@
+package seed
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BaseSet is loaded before the environment specific set on every run.
+const BaseSet = "base"
+
+// DecodeFunc unmarshals the content of a fixture file into v. YAML fixtures
+// are converted to JSON first, so the json tags of the target apply to both.
+type DecodeFunc func(v interface{}) error
+
+type Result struct {
+	Created int
+	Skipped int
+}
+
+// Loader applies one fixture file. It must be idempotent so seeds can be
+// re-run against a database that already contains them.
+type Loader func(decode DecodeFunc) (Result, error)
+
+type Seeder struct {
+	names   []string
+	loaders map[string]Loader
+}
+
+func New() *Seeder {
+	return &Seeder{loaders: map[string]Loader{}}
+}
+
+// Register binds a loader to the fixture files called name.yaml, name.yml or
+// name.json. Loaders run in registration order.
+func (s *Seeder) Register(name string, loader Loader) {
+	if _, ok := s.loaders[name]; !ok {
+		s.names = append(s.names, name)
+	}
+	s.loaders[name] = loader
+}
+
+// Run loads the base set and then the set of env from fsys, where every set
+// is a directory of fixture files.
+func (s *Seeder) Run(fsys fs.FS, env string) error {
+	sets := []string{BaseSet}
+	if env != "" && env != BaseSet {
+		sets = append(sets, env)
+	}
+
+	for _, set := range sets {
+		for _, name := range s.names {
+			file, data, err := readFixture(fsys, set, name)
+			if err != nil {
+				return err
+			}
+			if data == nil {
+				continue
+			}
+
+			result, err := s.loaders[name](decoder(file, data))
+			if err != nil {
+				return fmt.Errorf("failed to seed %s: %w", file, err)
+			}
+			fmt.Printf("Seeded %s: %d created, %d skipped\n", file, result.Created, result.Skipped)
+		}
+	}
+	return nil
+}
+
+func readFixture(fsys fs.FS, set, name string) (string, []byte, error) {
+	for _, ext := range []string{".yaml", ".yml", ".json"} {
+		file := path.Join(set, name+ext)
+		data, err := fs.ReadFile(fsys, file)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return file, nil, fmt.Errorf("failed to read fixture %s: %w", file, err)
+		}
+		return file, data, nil
+	}
+	return "", nil, nil
+}
+
+func decoder(file string, data []byte) DecodeFunc {
+	return func(v interface{}) error {
+		if path.Ext(file) != ".json" {
+			var doc interface{}
+			if err := yaml.Unmarshal(data, &doc); err != nil {
+				return err
+			}
+			converted, err := json.Marshal(doc)
+			if err != nil {
+				return err
+			}
+			data = converted
+		}
+		return json.Unmarshal(data, v)
+	}
+}
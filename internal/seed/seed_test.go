@@ -0,0 +1,50 @@
+package seed
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fixture struct {
+	Email string `json:"email"`
+}
+
+func TestSeeder_Run_LoadsBaseThenEnvironment(t *testing.T) {
+	fsys := fstest.MapFS{
+		"base/customers.yaml": {Data: []byte("- email: base@example.com\n")},
+		"qa/customers.json":   {Data: []byte(`[{"email": "qa@example.com"}]`)},
+		"dev/customers.yaml":  {Data: []byte("- email: dev@example.com\n")},
+	}
+
+	var loaded []string
+	seeder := New()
+	seeder.Register("customers", func(decode DecodeFunc) (Result, error) {
+		var fixtures []fixture
+		if err := decode(&fixtures); err != nil {
+			return Result{}, err
+		}
+		for _, f := range fixtures {
+			loaded = append(loaded, f.Email)
+		}
+		return Result{Created: len(fixtures)}, nil
+	})
+
+	err := seeder.Run(fsys, "qa")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"base@example.com", "qa@example.com"}, loaded)
+}
+
+func TestSeeder_Run_SkipsMissingFixtures(t *testing.T) {
+	called := false
+	seeder := New()
+	seeder.Register("customers", func(decode DecodeFunc) (Result, error) {
+		called = true
+		return Result{}, nil
+	})
+
+	err := seeder.Run(fstest.MapFS{}, "qa")
+	assert.NoError(t, err)
+	assert.False(t, called)
+}
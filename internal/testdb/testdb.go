@@ -0,0 +1,52 @@
+// Package testdb connects integration tests to the Postgres database at
+// TEST_DATABASE_DSN. The tests using it are skipped when the variable is not
+// set. Packages share the database, so they must not run in parallel.
+package testdb
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"test-go/migrations"
+	"test-go/pkg/migrate"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// DSN returns the DSN of the test database, skipping t when there is none.
+func DSN(t *testing.T) string {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	return dsn
+}
+
+// Connect opens dsn for t, closing it when t ends.
+func Connect(t *testing.T, dsn string) *gorm.DB {
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+// Open connects to the test database, migrates it and empties tables.
+func Open(t *testing.T, tables ...string) *gorm.DB {
+	db := Connect(t, DSN(t))
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+
+	all, err := migrate.Load(migrations.FS)
+	require.NoError(t, err)
+	require.NoError(t, migrate.NewRunner(sqlDB, all).Up())
+	if len(tables) > 0 {
+		require.NoError(t, db.Exec("TRUNCATE "+strings.Join(tables, ", ")+" RESTART IDENTITY CASCADE").Error)
+	}
+	return db
+}
@@ -0,0 +1,261 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"test-go/pkg/config"
+	database "test-go/pkg/db"
+	"test-go/pkg/logging"
+	"test-go/pkg/outbox"
+	"time"
+)
+
+// Headers of every delivery. The signature is "sha256=" followed by the hex
+// HMAC-SHA256, keyed with the webhook secret, of the timestamp, a dot and
+// the body.
+const (
+	HeaderSignature = "X-Webhook-Signature"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+)
+
+// Sign returns the signature header value of body sent at timestamp, in Unix seconds.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher turns outbox events into deliveries to the webhooks subscribed
+// to them. Its Handle method is subscribed to the outbox publisher.
+type Dispatcher struct {
+	repo Repository
+}
+
+func NewDispatcher(repo Repository) *Dispatcher {
+	return &Dispatcher{repo: repo}
+}
+
+// Handle stores one pending delivery of event per subscribed webhook. An
+// event published again by the outbox does not create deliveries twice. The
+// webhooks are read from the primary, so one just subscribed is not missed.
+func (d *Dispatcher) Handle(ctx context.Context, event outbox.Event) error {
+	ctx = database.ReadPrimary(ctx)
+	webhooks, err := d.repo.FindSubscribed(ctx, event.Type)
+	if err != nil || len(webhooks) == 0 {
+		return err
+	}
+
+	payload, err := json.Marshal(Payload{Id: event.Id, Type: event.Type, CreatedAt: event.CreatedAt, Data: event.Payload})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	deliveries := make([]Delivery, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		deliveries = append(deliveries, Delivery{
+			WebhookId:     webhook.Id,
+			EventId:       event.Id,
+			EventType:     event.Type,
+			Payload:       payload,
+			Status:        DeliveryPending,
+			NextAttemptAt: now,
+		})
+	}
+	return d.repo.CreateDeliveries(ctx, deliveries)
+}
+
+// Worker sends the pending deliveries. Several replicas may run one: each
+// delivery is claimed by a single worker at a time.
+type Worker struct {
+	repo   Repository
+	client *http.Client
+	cfg    config.WebhookConfig
+}
+
+func NewWorker(repo Repository, cfg config.WebhookConfig) *Worker {
+	// Deliveries never go through a proxy, whose address would be checked
+	// instead of the webhook's.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	if !cfg.AllowPrivateNetworks {
+		dialer := &net.Dialer{Timeout: cfg.Timeout, Control: dialPublic}
+		transport.DialContext = dialer.DialContext
+	}
+	return &Worker{
+		repo: repo,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   cfg.Timeout,
+			// a redirect is answered like any other non 2xx status
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		cfg: cfg,
+	}
+}
+
+// Run sends due deliveries every poll interval until ctx is canceled.
+func (w *Worker) Run(ctx context.Context) {
+	logger := logging.FromContext(ctx).With("worker", "webhook-delivery")
+	for {
+		sent, err := w.SendDue(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.Warn("failed to send webhook deliveries", "error", err)
+		}
+
+		wait := w.cfg.PollInterval
+		if sent == w.cfg.BatchSize {
+			// more deliveries are due
+			wait = 0
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// SendDue claims a batch of due deliveries, sends them concurrently and
+// records the outcomes. It returns how many deliveries it attempted. It reads
+// from the primary, where the claimed deliveries and their webhooks are
+// current.
+func (w *Worker) SendDue(ctx context.Context) (int, error) {
+	ctx = database.ReadPrimary(ctx)
+	// a worker that dies mid-batch leaves its deliveries to others once the lease ends
+	lease := time.Now().Add(2 * w.cfg.Timeout)
+	deliveries, err := w.repo.ClaimDueDeliveries(ctx, w.cfg.BatchSize, lease)
+	if err != nil || len(deliveries) == 0 {
+		return 0, err
+	}
+
+	ids := make([]uint, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		ids = append(ids, delivery.WebhookId)
+	}
+	webhooks, err := w.repo.FindByIds(ctx, ids)
+	if err != nil {
+		return 0, err
+	}
+	byId := make(map[uint]*Webhook, len(webhooks))
+	for i := range webhooks {
+		byId[webhooks[i].Id] = &webhooks[i]
+	}
+
+	var wg sync.WaitGroup
+	for i := range deliveries {
+		webhook, ok := byId[deliveries[i].WebhookId]
+		if !ok {
+			// deleted since the claim, its deliveries are gone with it
+			continue
+		}
+		wg.Add(1)
+		go func(delivery *Delivery) {
+			defer wg.Done()
+			w.deliver(ctx, webhook, delivery)
+		}(&deliveries[i])
+	}
+	wg.Wait()
+	return len(deliveries), nil
+}
+
+// deliver makes one attempt of delivery and records its outcome. A failed
+// attempt is retried after an exponential backoff until the attempts run out.
+func (w *Worker) deliver(ctx context.Context, webhook *Webhook, delivery *Delivery) {
+	logger := logging.FromContext(ctx).With("webhook_id", webhook.Id, "delivery_id", delivery.Id)
+
+	code, sendErr := w.send(ctx, webhook, delivery)
+	if ctx.Err() != nil {
+		// shutting down: the attempt is made again once the lease ends
+		return
+	}
+
+	delivery.Attempts++
+	delivery.ResponseCode = code
+	if sendErr == nil {
+		delivery.Status = DeliverySucceeded
+		delivery.LastError = ""
+	} else {
+		delivery.LastError = logging.Redact(sendErr.Error())
+		if delivery.Attempts >= w.cfg.MaxAttempts {
+			delivery.Status = DeliveryFailed
+		} else {
+			delivery.NextAttemptAt = time.Now().Add(w.backoff(delivery.Attempts))
+		}
+	}
+	if err := w.repo.SaveDelivery(ctx, delivery); err != nil {
+		logger.Error("failed to record webhook delivery", "error", err)
+		return
+	}
+
+	if sendErr == nil {
+		if err := w.repo.RecordSuccess(ctx, webhook.Id); err != nil {
+			logger.Error("failed to record webhook success", "error", err)
+		}
+		return
+	}
+
+	logger.Warn("webhook delivery failed", "error", delivery.LastError, "attempts", delivery.Attempts, "status", delivery.Status)
+	disabled, err := w.repo.RecordFailure(ctx, webhook.Id, w.cfg.DisableAfter)
+	if err != nil {
+		logger.Error("failed to record webhook failure", "error", err)
+		return
+	}
+	if disabled {
+		logger.Warn("webhook disabled after repeated failures", "failures", w.cfg.DisableAfter)
+	}
+}
+
+// send posts the delivery payload and returns the response status, nil when
+// there was no response. Any status but 2xx is an error.
+func (w *Worker) send(ctx context.Context, webhook *Webhook, delivery *Delivery) (*int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return nil, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "backend-go-api-webhooks")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(delivery.Id, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	// drain a little of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	code := resp.StatusCode
+	if code < 200 || code > 299 {
+		return &code, fmt.Errorf("receiver answered %d", code)
+	}
+	return &code, nil
+}
+
+// backoff returns the wait after the given number of failed attempts: the
+// base backoff, doubled after every further attempt, up to the maximum.
+func (w *Worker) backoff(attempts int) time.Duration {
+	wait := w.cfg.BaseBackoff
+	for i := 1; i < attempts && wait < w.cfg.MaxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, w.cfg.MaxBackoff)
+}
@@ -0,0 +1,356 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"test-go/pkg/config"
+	"test-go/pkg/outbox"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockRepository struct {
+	mu sync.Mutex
+
+	webhooks   []Webhook
+	deliveries []Delivery
+	// failures counts RecordFailure calls by webhook, successes RecordSuccess calls.
+	failures  map[uint]int
+	successes map[uint]int
+}
+
+func (m *mockRepository) Create(ctx context.Context, webhook *Webhook) error {
+	webhook.Id = uint(len(m.webhooks) + 1)
+	m.webhooks = append(m.webhooks, *webhook)
+	return nil
+}
+
+func (m *mockRepository) FindAllAndCount(ctx context.Context, page, perPage int) ([]Webhook, int64, error) {
+	return m.webhooks, int64(len(m.webhooks)), nil
+}
+
+func (m *mockRepository) FindById(ctx context.Context, id uint) (*Webhook, error) {
+	for i := range m.webhooks {
+		if m.webhooks[i].Id == id {
+			webhook := m.webhooks[i]
+			return &webhook, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockRepository) Update(ctx context.Context, webhook *Webhook) error {
+	for i := range m.webhooks {
+		if m.webhooks[i].Id == webhook.Id {
+			m.webhooks[i] = *webhook
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) DeleteById(ctx context.Context, id uint) (bool, error) {
+	for i := range m.webhooks {
+		if m.webhooks[i].Id == id {
+			m.webhooks = append(m.webhooks[:i], m.webhooks[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockRepository) FindSubscribed(ctx context.Context, eventType string) ([]Webhook, error) {
+	var webhooks []Webhook
+	for _, webhook := range m.webhooks {
+		if webhook.Enabled && webhook.Subscribes(eventType) {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return webhooks, nil
+}
+
+func (m *mockRepository) CreateDeliveries(ctx context.Context, deliveries []Delivery) error {
+	for _, delivery := range deliveries {
+		if m.findDelivery(delivery.WebhookId, delivery.EventId) == nil {
+			delivery.Id = uint64(len(m.deliveries) + 1)
+			m.deliveries = append(m.deliveries, delivery)
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) findDelivery(webhookId uint, eventId uint64) *Delivery {
+	for i := range m.deliveries {
+		if m.deliveries[i].WebhookId == webhookId && m.deliveries[i].EventId == eventId {
+			return &m.deliveries[i]
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) ClaimDueDeliveries(ctx context.Context, limit int, leaseUntil time.Time) ([]Delivery, error) {
+	var claimed []Delivery
+	for i := range m.deliveries {
+		delivery := &m.deliveries[i]
+		webhook, _ := m.FindById(ctx, delivery.WebhookId)
+		if delivery.Status == DeliveryPending && !delivery.NextAttemptAt.After(time.Now()) && webhook != nil && webhook.Enabled && len(claimed) < limit {
+			delivery.NextAttemptAt = leaseUntil
+			claimed = append(claimed, *delivery)
+		}
+	}
+	return claimed, nil
+}
+
+func (m *mockRepository) FindByIds(ctx context.Context, ids []uint) ([]Webhook, error) {
+	var webhooks []Webhook
+	for _, id := range ids {
+		if webhook, _ := m.FindById(ctx, id); webhook != nil {
+			webhooks = append(webhooks, *webhook)
+		}
+	}
+	return webhooks, nil
+}
+
+func (m *mockRepository) SaveDelivery(ctx context.Context, delivery *Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.deliveries {
+		if m.deliveries[i].Id == delivery.Id {
+			m.deliveries[i] = *delivery
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) RecordSuccess(ctx context.Context, webhookId uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.successes == nil {
+		m.successes = map[uint]int{}
+	}
+	m.successes[webhookId]++
+	return nil
+}
+
+func (m *mockRepository) RecordFailure(ctx context.Context, webhookId uint, disableAfter int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failures == nil {
+		m.failures = map[uint]int{}
+	}
+	m.failures[webhookId]++
+	for i := range m.webhooks {
+		webhook := &m.webhooks[i]
+		if webhook.Id == webhookId {
+			webhook.ConsecutiveFailures++
+			if webhook.Enabled && webhook.ConsecutiveFailures >= disableAfter {
+				webhook.Enabled = false
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (m *mockRepository) FindDeliveriesAndCount(ctx context.Context, webhookId uint, page, perPage int) ([]Delivery, int64, error) {
+	var deliveries []Delivery
+	for _, delivery := range m.deliveries {
+		if delivery.WebhookId == webhookId {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, int64(len(deliveries)), nil
+}
+
+func (m *mockRepository) FindDelivery(ctx context.Context, webhookId uint, deliveryId uint64) (*Delivery, error) {
+	for _, delivery := range m.deliveries {
+		if delivery.WebhookId == webhookId && delivery.Id == deliveryId {
+			return &delivery, nil
+		}
+	}
+	return nil, nil
+}
+
+func testWebhookConfig() config.WebhookConfig {
+	return config.WebhookConfig{
+		PollInterval: time.Second,
+		BatchSize:    10,
+		Timeout:      2 * time.Second,
+		MaxAttempts:  3,
+		BaseBackoff:  time.Minute,
+		MaxBackoff:   10 * time.Minute,
+		DisableAfter: 2,
+		// the test receivers listen on loopback
+		AllowPrivateNetworks: true,
+	}
+}
+
+// dispatch stores the deliveries of one customer event like the outbox relay would.
+func dispatch(t *testing.T, repo Repository, eventId uint64, eventType string) {
+	t.Helper()
+	event, err := outbox.NewEvent(eventType, "5", map[string]uint{"customerId": 5})
+	require.NoError(t, err)
+	event.Id = eventId
+	require.NoError(t, NewDispatcher(repo).Handle(context.Background(), *event))
+}
+
+// makeDue lets the worker attempt every pending delivery again right away.
+func makeDue(repo *mockRepository) {
+	for i := range repo.deliveries {
+		repo.deliveries[i].NextAttemptAt = time.Now().Add(-time.Second)
+	}
+}
+
+func TestWorker_SendsSignedPayload(t *testing.T) {
+	var received *http.Request
+	var body []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	repo := &mockRepository{webhooks: []Webhook{
+		{Id: 1, URL: receiver.URL, Secret: "s3cret", Enabled: true, Events: []string{"CustomerCreated"}},
+		{Id: 2, URL: receiver.URL, Secret: "other", Enabled: true, Events: []string{"CustomerDeleted"}},
+	}}
+	dispatch(t, repo, 42, "CustomerCreated")
+	dispatch(t, repo, 42, "CustomerCreated") // published again by the outbox
+	require.Len(t, repo.deliveries, 1, "only the subscribed webhook gets the event, once")
+
+	sent, err := NewWorker(repo, testWebhookConfig()).SendDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+
+	require.NotNil(t, received)
+	assert.Equal(t, "CustomerCreated", received.Header.Get(HeaderEvent))
+	assert.Equal(t, "1", received.Header.Get(HeaderDelivery))
+	timestamp, err := strconv.ParseInt(received.Header.Get(HeaderTimestamp), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, Sign("s3cret", timestamp, body), received.Header.Get(HeaderSignature))
+
+	var payload Payload
+	require.NoError(t, json.Unmarshal(body, &payload))
+	assert.Equal(t, uint64(42), payload.Id)
+	assert.JSONEq(t, `{"customerId":5}`, string(payload.Data))
+
+	delivery := repo.deliveries[0]
+	assert.Equal(t, DeliverySucceeded, delivery.Status)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Equal(t, http.StatusNoContent, *delivery.ResponseCode)
+	assert.Equal(t, 1, repo.successes[1])
+}
+
+func TestWorker_RetriesWithBackoffThenGivesUp(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	repo := &mockRepository{webhooks: []Webhook{{Id: 1, URL: receiver.URL, Secret: "s", Enabled: true}}}
+	cfg := testWebhookConfig()
+	cfg.DisableAfter = 100
+	worker := NewWorker(repo, cfg)
+	dispatch(t, repo, 1, "CustomerUpdated")
+
+	before := time.Now()
+	_, err := worker.SendDue(context.Background())
+	require.NoError(t, err)
+	delivery := repo.deliveries[0]
+	assert.Equal(t, DeliveryPending, delivery.Status)
+	assert.Equal(t, http.StatusServiceUnavailable, *delivery.ResponseCode)
+	assert.Equal(t, "receiver answered 503", delivery.LastError)
+	assert.WithinDuration(t, before.Add(cfg.BaseBackoff), delivery.NextAttemptAt, 5*time.Second)
+
+	sent, err := worker.SendDue(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, sent, "the retry waits for the backoff")
+
+	for range 2 {
+		makeDue(repo)
+		_, err = worker.SendDue(context.Background())
+		require.NoError(t, err)
+	}
+	assert.Equal(t, DeliveryFailed, repo.deliveries[0].Status)
+	assert.Equal(t, 3, repo.deliveries[0].Attempts)
+	assert.Equal(t, 3, repo.failures[1])
+}
+
+func TestWorker_DisablesWebhookAfterRepeatedFailures(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	repo := &mockRepository{webhooks: []Webhook{{Id: 1, URL: receiver.URL, Secret: "s", Enabled: true}}}
+	worker := NewWorker(repo, testWebhookConfig())
+	dispatch(t, repo, 1, "CustomerUpdated")
+	dispatch(t, repo, 2, "CustomerUpdated")
+
+	_, err := worker.SendDue(context.Background())
+	require.NoError(t, err)
+	assert.False(t, repo.webhooks[0].Enabled)
+
+	dispatch(t, repo, 3, "CustomerUpdated")
+	assert.Len(t, repo.deliveries, 2, "a disabled webhook gets no new deliveries")
+	makeDue(repo)
+	sent, err := worker.SendDue(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, sent, "deliveries of a disabled webhook are not sent")
+}
+
+func TestWorker_DoesNotFollowRedirects(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the redirect was followed")
+	}))
+	defer target.Close()
+	receiver := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusFound))
+	defer receiver.Close()
+
+	repo := &mockRepository{webhooks: []Webhook{{Id: 1, URL: receiver.URL, Secret: "s", Enabled: true}}}
+	dispatch(t, repo, 1, "CustomerCreated")
+	_, err := NewWorker(repo, testWebhookConfig()).SendDue(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusFound, *repo.deliveries[0].ResponseCode)
+	assert.Equal(t, DeliveryPending, repo.deliveries[0].Status)
+}
+
+func TestWorker_RefusesToConnectToPrivateAddresses(t *testing.T) {
+	called := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer receiver.Close()
+
+	// registered while the host resolved to a public address
+	repo := &mockRepository{webhooks: []Webhook{{Id: 1, URL: receiver.URL, Secret: "s3cret", Enabled: true}}}
+	dispatch(t, repo, 42, "CustomerCreated")
+	cfg := testWebhookConfig()
+	cfg.AllowPrivateNetworks = false
+
+	_, err := NewWorker(repo, cfg).SendDue(context.Background())
+	require.NoError(t, err)
+	assert.False(t, called)
+	assert.Contains(t, repo.deliveries[0].LastError, errPrivateAddress.Error())
+}
+
+func TestWorker_BackoffDoublesUpToMaximum(t *testing.T) {
+	worker := NewWorker(nil, testWebhookConfig())
+
+	var waits []time.Duration
+	for attempts := 1; attempts <= 6; attempts++ {
+		waits = append(waits, worker.backoff(attempts))
+	}
+	assert.Equal(t, []time.Duration{
+		time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 10 * time.Minute, 10 * time.Minute,
+	}, waits)
+}
@@ -0,0 +1,269 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"test-go/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler struct {
+	Service Service
+}
+
+func NewHandler(service Service) *Handler {
+	return &Handler{Service: service}
+}
+
+// @Tags Webhooks
+// @Summary Create a webhook
+// @Description Subscribe a URL to customer events. The response holds the signing secret, which is not shown again.
+// @Accept  json
+// @Produce  json
+// @Param webhook body WebhookCreateBody true "Webhook"
+// @Success 201 {object} WebhookCreateResponse
+// @Failure 400 {object} common.ResponseError
+// @Failure 500 {object} common.ResponseError
+// @Router /webhooks/ [post]
+func (h *Handler) Create(c *gin.Context) {
+	var body WebhookCreateBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, common.ResponseError{Error: err.Error()})
+		return
+	}
+
+	webhook, err := h.Service.Create(c.Request.Context(), &WebhookServiceCreateInput{
+		WebhookCreateBody: body,
+		CreatedBy:         common.Principal(c),
+	})
+	if errors.Is(err, ErrInvalidInput) {
+		c.JSON(http.StatusBadRequest, common.ResponseError{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		common.InternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"data": WebhookCreateResponse{WebhookResponse: toWebhookResponse(webhook), Secret: webhook.Secret},
+	})
+}
+
+// @Tags Webhooks
+// @Summary Get all webhooks
+// @Produce  json
+// @Param page query int false "Page number" default(1) minimum(1)
+// @Param perPage query int false "Items per page" default(10) minimum(1) maximum(100)
+// @Success 200 {object} common.PaginatedResponse[WebhookResponse]
+// @Failure 400 {object} common.ResponseError
+// @Failure 500 {object} common.ResponseError
+// @Router /webhooks/ [get]
+func (h *Handler) Index(c *gin.Context) {
+	var query WebhookIndexQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, common.ResponseError{Error: err.Error()})
+		return
+	}
+
+	webhooks, err := h.Service.FindAllAndCount(c.Request.Context(), query)
+	if err != nil {
+		common.InternalError(c, err)
+		return
+	}
+
+	responses := make([]WebhookResponse, 0, len(webhooks.Data))
+	for i := range webhooks.Data {
+		responses = append(responses, toWebhookResponse(&webhooks.Data[i]))
+	}
+	c.JSON(http.StatusOK, common.BuildPaginatedResponseFromQuery(responses, int(webhooks.TotalItems), query.PaginationQuery))
+}
+
+// @Tags Webhooks
+// @Summary Get a webhook by ID
+// @Produce  json
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} WebhookResponse
+// @Failure 400 {object} common.ResponseError
+// @Failure 404 {object} common.ResponseError
+// @Failure 500 {object} common.ResponseError
+// @Router /webhooks/{id} [get]
+func (h *Handler) Show(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, common.ResponseError{Error: "invalid webhook ID"})
+		return
+	}
+
+	webhook, err := h.Service.FindById(c.Request.Context(), uint(id))
+	if err != nil {
+		common.InternalError(c, err)
+		return
+	}
+	if webhook == nil {
+		c.JSON(http.StatusNotFound, common.ResponseError{Error: "webhook not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": toWebhookResponse(webhook)})
+}
+
+// @Tags Webhooks
+// @Summary Update a webhook
+// @Description Change the URL, events or secret of a webhook, or enable or disable it. Enabling it resets its failure count.
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Webhook ID"
+// @Param webhook body WebhookUpdateBody true "Webhook"
+// @Success 200 {object} WebhookResponse
+// @Failure 400 {object} common.ResponseError
+// @Failure 404 {object} common.ResponseError
+// @Failure 500 {object} common.ResponseError
+// @Router /webhooks/{id} [put]
+func (h *Handler) Update(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, common.ResponseError{Error: "invalid webhook ID"})
+		return
+	}
+	var body WebhookUpdateBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, common.ResponseError{Error: err.Error()})
+		return
+	}
+
+	webhook, err := h.Service.UpdateById(c.Request.Context(), uint(id), &WebhookServiceUpdateInput{
+		WebhookUpdateBody: body,
+		UpdatedBy:         common.Principal(c),
+	})
+	if errors.Is(err, ErrInvalidInput) {
+		c.JSON(http.StatusBadRequest, common.ResponseError{Error: err.Error()})
+		return
+	}
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, common.ResponseError{Error: "webhook not found"})
+		return
+	}
+	if err != nil {
+		common.InternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": toWebhookResponse(webhook)})
+}
+
+// @Tags Webhooks
+// @Summary Delete a webhook
+// @Description Delete a webhook and its delivery log
+// @Param id path int true "Webhook ID"
+// @Success 204 {string} string "No Content"
+// @Failure 400 {object} common.ResponseError
+// @Failure 404 {object} common.ResponseError
+// @Failure 500 {object} common.ResponseError
+// @Router /webhooks/{id} [delete]
+func (h *Handler) Delete(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, common.ResponseError{Error: "invalid webhook ID"})
+		return
+	}
+
+	err = h.Service.DeleteById(c.Request.Context(), uint(id))
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, common.ResponseError{Error: "webhook not found"})
+		return
+	}
+	if err != nil {
+		common.InternalError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// @Tags Webhooks
+// @Summary Get the deliveries of a webhook
+// @Description Retrieve the delivery log of a webhook with the outcome of the last attempt of each delivery, newest first
+// @Produce  json
+// @Param id path int true "Webhook ID"
+// @Param page query int false "Page number" default(1) minimum(1)
+// @Param perPage query int false "Items per page" default(10) minimum(1) maximum(100)
+// @Success 200 {object} common.PaginatedResponse[DeliveryResponse]
+// @Failure 400 {object} common.ResponseError
+// @Failure 500 {object} common.ResponseError
+// @Router /webhooks/{id}/deliveries [get]
+func (h *Handler) Deliveries(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, common.ResponseError{Error: "invalid webhook ID"})
+		return
+	}
+	var query DeliveryIndexQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, common.ResponseError{Error: err.Error()})
+		return
+	}
+
+	deliveries, err := h.Service.FindDeliveries(c.Request.Context(), uint(id), query)
+	if err != nil {
+		common.InternalError(c, err)
+		return
+	}
+
+	responses := make([]DeliveryResponse, 0, len(deliveries.Data))
+	for i := range deliveries.Data {
+		responses = append(responses, toDeliveryResponse(&deliveries.Data[i]))
+	}
+	c.JSON(http.StatusOK, common.BuildPaginatedResponseFromQuery(responses, int(deliveries.TotalItems), query.PaginationQuery))
+}
+
+// @Tags Webhooks
+// @Summary Redeliver an event
+// @Description Send a delivery again as soon as possible, with a new round of attempts
+// @Param id path int true "Webhook ID"
+// @Param deliveryId path int true "Delivery ID"
+// @Success 202 {string} string "Accepted"
+// @Failure 400 {object} common.ResponseError
+// @Failure 404 {object} common.ResponseError
+// @Failure 409 {object} common.ResponseError
+// @Failure 500 {object} common.ResponseError
+// @Router /webhooks/{id}/deliveries/{deliveryId}/redeliver [post]
+func (h *Handler) Redeliver(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, common.ResponseError{Error: "invalid webhook ID"})
+		return
+	}
+	deliveryId, err := strconv.ParseUint(c.Param("deliveryId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, common.ResponseError{Error: "invalid delivery ID"})
+		return
+	}
+
+	err = h.Service.Redeliver(c.Request.Context(), uint(id), deliveryId)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, common.ResponseError{Error: "delivery not found"})
+		return
+	}
+	if errors.Is(err, ErrDisabled) {
+		c.JSON(http.StatusConflict, common.ResponseError{Error: "webhook is disabled, enable it first"})
+		return
+	}
+	if err != nil {
+		common.InternalError(c, err)
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	webhooks := rg.Group("/webhooks")
+	webhooks.POST("/", h.Create)
+	webhooks.GET("/", h.Index)
+	webhooks.GET("/:id", h.Show)
+	webhooks.PUT("/:id", h.Update)
+	webhooks.DELETE("/:id", h.Delete)
+	webhooks.GET("/:id/deliveries", h.Deliveries)
+	webhooks.POST("/:id/deliveries/:deliveryId/redeliver", h.Redeliver)
+}
@@ -0,0 +1,66 @@
+package webhook
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Webhook is a partner endpoint receiving the customer events listed in
+// Events, or every event when Events is empty.
+type Webhook struct {
+	Id     uint     `gorm:"primaryKey;type:serial" json:"id"`
+	URL    string   `gorm:"column:url" json:"url"`
+	Events []string `gorm:"serializer:json;type:jsonb;not null" json:"events"`
+	// Secret signs the deliveries. It is only shown when the webhook is created.
+	Secret  string `json:"-"`
+	Enabled bool   `json:"enabled"`
+	// ConsecutiveFailures counts the failed attempts since the last success.
+	// The webhook is disabled once it reaches the configured limit.
+	ConsecutiveFailures int        `gorm:"type:integer" json:"consecutive_failures"`
+	DisabledAt          *time.Time `gorm:"type:timestamptz" json:"disabled_at"`
+	CreatedBy           string     `json:"created_by"`
+	CreatedAt           time.Time  `gorm:"type:timestamptz" json:"created_at"`
+	UpdatedBy           string     `json:"updated_by"`
+	UpdatedAt           time.Time  `gorm:"type:timestamptz" json:"updated_at"`
+}
+
+// Subscribes reports whether the webhook receives events of eventType.
+func (w *Webhook) Subscribes(eventType string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, event := range w.Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery statuses.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Delivery is the sending of one event to one webhook, with the outcome of
+// its last attempt. Payload is the exact body sent on every attempt.
+type Delivery struct {
+	Id            uint64          `gorm:"primaryKey;type:bigserial" json:"id"`
+	WebhookId     uint            `gorm:"type:integer;uniqueIndex:webhook_deliveries_webhook_id_event_id_key,priority:1" json:"webhook_id"`
+	EventId       uint64          `gorm:"type:bigint;uniqueIndex:webhook_deliveries_webhook_id_event_id_key,priority:2" json:"event_id"`
+	EventType     string          `json:"event_type"`
+	Payload       json.RawMessage `gorm:"type:jsonb;not null" json:"payload"`
+	Status        string          `json:"status"`
+	Attempts      int             `gorm:"type:integer" json:"attempts"`
+	NextAttemptAt time.Time       `gorm:"type:timestamptz;index:webhook_deliveries_due_idx,where:status = 'pending'" json:"next_attempt_at"`
+	ResponseCode  *int            `gorm:"type:integer" json:"response_code"`
+	LastError     string          `json:"last_error"`
+	CreatedAt     time.Time       `gorm:"type:timestamptz" json:"created_at"`
+	UpdatedAt     time.Time       `gorm:"type:timestamptz" json:"updated_at"`
+}
+
+func (Delivery) TableName() string {
+	return "webhook_deliveries"
+}
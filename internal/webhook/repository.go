@@ -0,0 +1,225 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"test-go/pkg/tracing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repository interface {
+	Create(ctx context.Context, webhook *Webhook) error
+	FindAllAndCount(ctx context.Context, page, perPage int) ([]Webhook, int64, error)
+	// FindById returns nil when there is no such webhook.
+	FindById(ctx context.Context, id uint) (*Webhook, error)
+	Update(ctx context.Context, webhook *Webhook) error
+	// DeleteById deletes the webhook and its deliveries and reports whether
+	// there was such a webhook.
+	DeleteById(ctx context.Context, id uint) (bool, error)
+	// FindSubscribed returns the enabled webhooks receiving events of eventType.
+	FindSubscribed(ctx context.Context, eventType string) ([]Webhook, error)
+	// CreateDeliveries adds the deliveries, skipping those of events the
+	// webhook already has a delivery for.
+	CreateDeliveries(ctx context.Context, deliveries []Delivery) error
+	// ClaimDueDeliveries returns up to limit pending deliveries of enabled
+	// webhooks that are due, and postpones them until leaseUntil so other
+	// workers leave them alone while they are sent.
+	ClaimDueDeliveries(ctx context.Context, limit int, leaseUntil time.Time) ([]Delivery, error)
+	FindByIds(ctx context.Context, ids []uint) ([]Webhook, error)
+	SaveDelivery(ctx context.Context, delivery *Delivery) error
+	// RecordSuccess resets the consecutive failures of the webhook.
+	RecordSuccess(ctx context.Context, webhookId uint) error
+	// RecordFailure counts a failed attempt of the webhook and disables it
+	// once it failed disableAfter times in a row. It reports whether the
+	// webhook was disabled by this failure.
+	RecordFailure(ctx context.Context, webhookId uint, disableAfter int) (bool, error)
+	FindDeliveriesAndCount(ctx context.Context, webhookId uint, page, perPage int) ([]Delivery, int64, error)
+	// FindDelivery returns nil when the webhook has no such delivery.
+	FindDelivery(ctx context.Context, webhookId uint, deliveryId uint64) (*Delivery, error)
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db}
+}
+
+func (r *repository) Create(ctx context.Context, webhook *Webhook) (err error) {
+	ctx, span := tracer.Start(ctx, "webhook.Repository.Create")
+	defer func() { tracing.End(span, err) }()
+
+	return r.db.WithContext(ctx).Create(webhook).Error
+}
+
+func (r *repository) FindAllAndCount(ctx context.Context, page, perPage int) (_ []Webhook, _ int64, err error) {
+	ctx, span := tracer.Start(ctx, "webhook.Repository.FindAllAndCount")
+	defer func() { tracing.End(span, err) }()
+
+	var webhooks []Webhook
+	var total int64
+	db := r.db.WithContext(ctx).Model(&Webhook{})
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := db.Order("id").Limit(perPage).Offset((page - 1) * perPage).Find(&webhooks).Error; err != nil {
+		return nil, 0, err
+	}
+	return webhooks, total, nil
+}
+
+func (r *repository) FindById(ctx context.Context, id uint) (_ *Webhook, err error) {
+	ctx, span := tracer.Start(ctx, "webhook.Repository.FindById")
+	defer func() { tracing.End(span, err) }()
+
+	var webhook Webhook
+	err = r.db.WithContext(ctx).First(&webhook, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (r *repository) Update(ctx context.Context, webhook *Webhook) (err error) {
+	ctx, span := tracer.Start(ctx, "webhook.Repository.Update")
+	defer func() { tracing.End(span, err) }()
+
+	return r.db.WithContext(ctx).Save(webhook).Error
+}
+
+func (r *repository) DeleteById(ctx context.Context, id uint) (_ bool, err error) {
+	ctx, span := tracer.Start(ctx, "webhook.Repository.DeleteById")
+	defer func() { tracing.End(span, err) }()
+
+	result := r.db.WithContext(ctx).Delete(&Webhook{}, id)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *repository) FindSubscribed(ctx context.Context, eventType string) (_ []Webhook, err error) {
+	ctx, span := tracer.Start(ctx, "webhook.Repository.FindSubscribed")
+	defer func() { tracing.End(span, err) }()
+
+	filter, err := json.Marshal([]string{eventType})
+	if err != nil {
+		return nil, err
+	}
+
+	var webhooks []Webhook
+	err = r.db.WithContext(ctx).
+		Where("enabled AND (events = '[]'::jsonb OR events @> ?::jsonb)", string(filter)).
+		Order("id").
+		Find(&webhooks).Error
+	return webhooks, err
+}
+
+func (r *repository) CreateDeliveries(ctx context.Context, deliveries []Delivery) (err error) {
+	ctx, span := tracer.Start(ctx, "webhook.Repository.CreateDeliveries")
+	defer func() { tracing.End(span, err) }()
+
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "webhook_id"}, {Name: "event_id"}}, DoNothing: true}).
+		Create(&deliveries).Error
+}
+
+func (r *repository) ClaimDueDeliveries(ctx context.Context, limit int, leaseUntil time.Time) (_ []Delivery, err error) {
+	ctx, span := tracer.Start(ctx, "webhook.Repository.ClaimDueDeliveries")
+	defer func() { tracing.End(span, err) }()
+
+	var deliveries []Delivery
+	err = r.db.WithContext(ctx).Raw(`
+		UPDATE webhook_deliveries SET next_attempt_at = ?, updated_at = NOW()
+		WHERE id IN (
+			SELECT d.id FROM webhook_deliveries d
+			JOIN webhooks w ON w.id = d.webhook_id
+			WHERE d.status = ? AND d.next_attempt_at <= NOW() AND w.enabled
+			ORDER BY d.next_attempt_at
+			LIMIT ?
+			FOR UPDATE OF d SKIP LOCKED
+		)
+		RETURNING *`, leaseUntil, DeliveryPending, limit).
+		Scan(&deliveries).Error
+	return deliveries, err
+}
+
+func (r *repository) FindByIds(ctx context.Context, ids []uint) (_ []Webhook, err error) {
+	ctx, span := tracer.Start(ctx, "webhook.Repository.FindByIds")
+	defer func() { tracing.End(span, err) }()
+
+	var webhooks []Webhook
+	err = r.db.WithContext(ctx).Where("id IN ?", ids).Find(&webhooks).Error
+	return webhooks, err
+}
+
+func (r *repository) SaveDelivery(ctx context.Context, delivery *Delivery) (err error) {
+	ctx, span := tracer.Start(ctx, "webhook.Repository.SaveDelivery")
+	defer func() { tracing.End(span, err) }()
+
+	return r.db.WithContext(ctx).Save(delivery).Error
+}
+
+func (r *repository) RecordSuccess(ctx context.Context, webhookId uint) (err error) {
+	ctx, span := tracer.Start(ctx, "webhook.Repository.RecordSuccess")
+	defer func() { tracing.End(span, err) }()
+
+	return r.db.WithContext(ctx).Model(&Webhook{}).
+		Where("id = ? AND consecutive_failures > 0", webhookId).
+		Update("consecutive_failures", 0).Error
+}
+
+func (r *repository) RecordFailure(ctx context.Context, webhookId uint, disableAfter int) (_ bool, err error) {
+	ctx, span := tracer.Start(ctx, "webhook.Repository.RecordFailure")
+	defer func() { tracing.End(span, err) }()
+
+	db := r.db.WithContext(ctx)
+	if err := db.Model(&Webhook{}).Where("id = ?", webhookId).
+		Update("consecutive_failures", gorm.Expr("consecutive_failures + 1")).Error; err != nil {
+		return false, err
+	}
+
+	result := db.Model(&Webhook{}).
+		Where("id = ? AND enabled AND consecutive_failures >= ?", webhookId, disableAfter).
+		Updates(map[string]interface{}{"enabled": false, "disabled_at": time.Now()})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *repository) FindDeliveriesAndCount(ctx context.Context, webhookId uint, page, perPage int) (_ []Delivery, _ int64, err error) {
+	ctx, span := tracer.Start(ctx, "webhook.Repository.FindDeliveriesAndCount")
+	defer func() { tracing.End(span, err) }()
+
+	var deliveries []Delivery
+	var total int64
+	db := r.db.WithContext(ctx).Model(&Delivery{}).Where("webhook_id = ?", webhookId)
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := db.Order("id DESC").Limit(perPage).Offset((page - 1) * perPage).Find(&deliveries).Error; err != nil {
+		return nil, 0, err
+	}
+	return deliveries, total, nil
+}
+
+func (r *repository) FindDelivery(ctx context.Context, webhookId uint, deliveryId uint64) (_ *Delivery, err error) {
+	ctx, span := tracer.Start(ctx, "webhook.Repository.FindDelivery")
+	defer func() { tracing.End(span, err) }()
+
+	var delivery Delivery
+	err = r.db.WithContext(ctx).Where("id = ? AND webhook_id = ?", deliveryId, webhookId).First(&delivery).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
@@ -0,0 +1,13 @@
+package webhook
+
+import (
+	"test-go/pkg/config"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func RegisterRoutes(rg *gin.RouterGroup, db *gorm.DB, cfg config.WebhookConfig) {
+	handler := NewHandler(NewService(NewRepository(db), cfg))
+	handler.RegisterRoutes(rg)
+}
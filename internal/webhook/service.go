@@ -0,0 +1,242 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"test-go/internal/customer"
+	"test-go/pkg/config"
+	"test-go/pkg/tracing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("test-go/internal/webhook")
+
+var (
+	ErrInvalidInput = errors.New("invalid webhook input")
+	ErrNotFound     = errors.New("webhook not found")
+	// ErrDisabled is returned when redelivering to a disabled webhook, which
+	// must be enabled again first.
+	ErrDisabled = errors.New("webhook is disabled")
+)
+
+// eventTypes are the event types a webhook can subscribe to.
+var eventTypes = []string{
+	customer.EventCustomerCreated,
+	customer.EventCustomerUpdated,
+	customer.EventCustomerDeleted,
+	customer.EventCustomerRestored,
+	customer.EventCustomerPurged,
+}
+
+type Service interface {
+	// Create returns the created webhook, whose Secret is the only copy the
+	// caller gets.
+	Create(ctx context.Context, input *WebhookServiceCreateInput) (*Webhook, error)
+	FindAllAndCount(ctx context.Context, query WebhookIndexQuery) (WebhookServiceFindAllAndCount, error)
+	FindById(ctx context.Context, id uint) (*Webhook, error)
+	UpdateById(ctx context.Context, id uint, input *WebhookServiceUpdateInput) (*Webhook, error)
+	DeleteById(ctx context.Context, id uint) error
+	FindDeliveries(ctx context.Context, id uint, query DeliveryIndexQuery) (WebhookServiceFindDeliveries, error)
+	// Redeliver sends a delivery of the webhook again as soon as possible,
+	// with a new round of attempts.
+	Redeliver(ctx context.Context, id uint, deliveryId uint64) error
+}
+
+type service struct {
+	repo                 Repository
+	allowPrivateNetworks bool
+}
+
+func NewService(r Repository, cfg config.WebhookConfig) Service {
+	return &service{repo: r, allowPrivateNetworks: cfg.AllowPrivateNetworks}
+}
+
+func (s *service) Create(ctx context.Context, input *WebhookServiceCreateInput) (_ *Webhook, err error) {
+	ctx, span := tracer.Start(ctx, "webhook.Service.Create")
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.validate(ctx, input.URL, input.Events); err != nil {
+		return nil, err
+	}
+	secret := input.Secret
+	if secret == "" {
+		if secret, err = newSecret(); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	webhook := &Webhook{
+		URL:       strings.TrimSpace(input.URL),
+		Events:    normalizeEvents(input.Events),
+		Secret:    secret,
+		Enabled:   true,
+		CreatedBy: input.CreatedBy,
+		CreatedAt: now,
+		UpdatedBy: input.CreatedBy,
+		UpdatedAt: now,
+	}
+	if err := s.repo.Create(ctx, webhook); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (s *service) FindAllAndCount(ctx context.Context, query WebhookIndexQuery) (_ WebhookServiceFindAllAndCount, err error) {
+	ctx, span := tracer.Start(ctx, "webhook.Service.FindAllAndCount")
+	defer func() { tracing.End(span, err) }()
+
+	webhooks, total, err := s.repo.FindAllAndCount(ctx, query.Page, query.PerPage)
+	if err != nil {
+		return WebhookServiceFindAllAndCount{}, err
+	}
+	return WebhookServiceFindAllAndCount{Data: webhooks, TotalItems: total}, nil
+}
+
+func (s *service) FindById(ctx context.Context, id uint) (_ *Webhook, err error) {
+	ctx, span := tracer.Start(ctx, "webhook.Service.FindById", trace.WithAttributes(attribute.Int64("webhook.id", int64(id))))
+	defer func() { tracing.End(span, err) }()
+
+	return s.repo.FindById(ctx, id)
+}
+
+func (s *service) UpdateById(ctx context.Context, id uint, input *WebhookServiceUpdateInput) (_ *Webhook, err error) {
+	ctx, span := tracer.Start(ctx, "webhook.Service.UpdateById", trace.WithAttributes(attribute.Int64("webhook.id", int64(id))))
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.validate(ctx, input.URL, input.Events); err != nil {
+		return nil, err
+	}
+	webhook, err := s.repo.FindById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if webhook == nil {
+		return nil, ErrNotFound
+	}
+
+	webhook.URL = strings.TrimSpace(input.URL)
+	webhook.Events = normalizeEvents(input.Events)
+	if input.Secret != "" {
+		webhook.Secret = input.Secret
+	}
+	if *input.Enabled && !webhook.Enabled {
+		webhook.ConsecutiveFailures = 0
+		webhook.DisabledAt = nil
+	}
+	if !*input.Enabled && webhook.Enabled {
+		now := time.Now()
+		webhook.DisabledAt = &now
+	}
+	webhook.Enabled = *input.Enabled
+	webhook.UpdatedBy = input.UpdatedBy
+	webhook.UpdatedAt = time.Now()
+
+	if err := s.repo.Update(ctx, webhook); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (s *service) DeleteById(ctx context.Context, id uint) (err error) {
+	ctx, span := tracer.Start(ctx, "webhook.Service.DeleteById", trace.WithAttributes(attribute.Int64("webhook.id", int64(id))))
+	defer func() { tracing.End(span, err) }()
+
+	deleted, err := s.repo.DeleteById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *service) FindDeliveries(ctx context.Context, id uint, query DeliveryIndexQuery) (_ WebhookServiceFindDeliveries, err error) {
+	ctx, span := tracer.Start(ctx, "webhook.Service.FindDeliveries", trace.WithAttributes(attribute.Int64("webhook.id", int64(id))))
+	defer func() { tracing.End(span, err) }()
+
+	deliveries, total, err := s.repo.FindDeliveriesAndCount(ctx, id, query.Page, query.PerPage)
+	if err != nil {
+		return WebhookServiceFindDeliveries{}, err
+	}
+	return WebhookServiceFindDeliveries{Data: deliveries, TotalItems: total}, nil
+}
+
+func (s *service) Redeliver(ctx context.Context, id uint, deliveryId uint64) (err error) {
+	ctx, span := tracer.Start(ctx, "webhook.Service.Redeliver", trace.WithAttributes(attribute.Int64("webhook.id", int64(id))))
+	defer func() { tracing.End(span, err) }()
+
+	webhook, err := s.repo.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if webhook == nil {
+		return ErrNotFound
+	}
+	if !webhook.Enabled {
+		return ErrDisabled
+	}
+
+	delivery, err := s.repo.FindDelivery(ctx, id, deliveryId)
+	if err != nil {
+		return err
+	}
+	if delivery == nil {
+		return ErrNotFound
+	}
+
+	delivery.Status = DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now()
+	return s.repo.SaveDelivery(ctx, delivery)
+}
+
+// validate checks that target is an absolute http(s) URL of a public host,
+// unless private networks are allowed, and that events only lists known event
+// types.
+func (s *service) validate(ctx context.Context, target string, events []string) error {
+	u, err := url.Parse(strings.TrimSpace(target))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidInput)
+	}
+	if !s.allowPrivateNetworks {
+		if err := checkHost(ctx, u.Hostname()); err != nil {
+			return fmt.Errorf("%w: url %w", ErrInvalidInput, err)
+		}
+	}
+	for _, event := range events {
+		if !slices.Contains(eventTypes, event) {
+			return fmt.Errorf("%w: unknown event %q, must be one of %v", ErrInvalidInput, event, eventTypes)
+		}
+	}
+	return nil
+}
+
+func normalizeEvents(events []string) []string {
+	normalized := slices.Clone(events)
+	slices.Sort(normalized)
+	normalized = slices.Compact(normalized)
+	if normalized == nil {
+		normalized = []string{}
+	}
+	return normalized
+}
+
+func newSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
@@ -0,0 +1,113 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"test-go/pkg/config"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_CreateValidatesAndGeneratesSecret(t *testing.T) {
+	svc := NewService(&mockRepository{}, config.WebhookConfig{})
+
+	for _, body := range []WebhookCreateBody{
+		{URL: "ftp://partner.example.com"},
+		{URL: "/relative/path"},
+		{URL: "https://partner.example.com", Events: []string{"CustomerExploded"}},
+	} {
+		_, err := svc.Create(context.Background(), &WebhookServiceCreateInput{WebhookCreateBody: body})
+		assert.True(t, errors.Is(err, ErrInvalidInput), "%+v", body)
+	}
+
+	webhook, err := svc.Create(context.Background(), &WebhookServiceCreateInput{
+		WebhookCreateBody: WebhookCreateBody{
+			URL:    " https://partner.example.com/hooks ",
+			Events: []string{"CustomerUpdated", "CustomerCreated", "CustomerUpdated"},
+		},
+		CreatedBy: "admin@example.com",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "https://partner.example.com/hooks", webhook.URL)
+	assert.Equal(t, []string{"CustomerCreated", "CustomerUpdated"}, webhook.Events)
+	assert.Len(t, webhook.Secret, 64)
+	assert.True(t, webhook.Enabled)
+}
+
+func TestService_RejectsPrivateAddresses(t *testing.T) {
+	svc := NewService(&mockRepository{}, config.WebhookConfig{})
+
+	for _, url := range []string{
+		"http://127.0.0.1:8080/hooks",
+		"http://localhost/hooks",
+		"http://[::1]/hooks",
+		"http://0.0.0.0/hooks",
+		"http://10.1.2.3/hooks",
+		"http://172.16.0.1/hooks",
+		"https://192.168.1.10/hooks",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[fe80::1]/hooks",
+		"http://[fd00::1]/hooks",
+		"http://[::ffff:127.0.0.1]/hooks",
+		"http://0.1.2.3/hooks",
+		"http://100.64.0.1/hooks",
+		"http://100.127.255.254/hooks",
+		"http://192.0.0.8/hooks",
+		"http://198.18.0.1/hooks",
+		"http://198.19.255.1/hooks",
+		"http://255.255.255.255/hooks",
+		"http://[64:ff9b::a00:1]/hooks",
+		"http://[64:ff9b::7f00:1]/hooks",
+		"http://[64:ff9b:1::1]/hooks",
+	} {
+		_, err := svc.Create(context.Background(), &WebhookServiceCreateInput{WebhookCreateBody: WebhookCreateBody{URL: url}})
+		assert.ErrorIs(t, err, ErrInvalidInput, url)
+		assert.ErrorIs(t, err, errPrivateAddress, url)
+	}
+
+	for _, url := range []string{"https://203.0.113.7/hooks", "https://100.128.0.1/hooks", "https://198.20.0.1/hooks", "https://[2001:db8::1]/hooks"} {
+		_, err := svc.Create(context.Background(), &WebhookServiceCreateInput{WebhookCreateBody: WebhookCreateBody{URL: url}})
+		assert.NoError(t, err, url)
+	}
+
+	local := NewService(&mockRepository{}, config.WebhookConfig{AllowPrivateNetworks: true})
+	_, err := local.Create(context.Background(), &WebhookServiceCreateInput{WebhookCreateBody: WebhookCreateBody{URL: "http://localhost:9000/hooks"}})
+	assert.NoError(t, err)
+}
+
+func TestService_EnablingResetsFailures(t *testing.T) {
+	repo := &mockRepository{webhooks: []Webhook{{Id: 1, URL: "https://a.example.com", Secret: "old", ConsecutiveFailures: 20}}}
+	svc := NewService(repo, config.WebhookConfig{})
+	enabled := true
+
+	webhook, err := svc.UpdateById(context.Background(), 1, &WebhookServiceUpdateInput{
+		WebhookUpdateBody: WebhookUpdateBody{URL: "https://b.example.com", Enabled: &enabled},
+	})
+	require.NoError(t, err)
+	assert.True(t, webhook.Enabled)
+	assert.Zero(t, webhook.ConsecutiveFailures)
+	assert.Nil(t, webhook.DisabledAt)
+	assert.Equal(t, "old", webhook.Secret, "an empty secret keeps the current one")
+
+	_, err = svc.UpdateById(context.Background(), 2, &WebhookServiceUpdateInput{
+		WebhookUpdateBody: WebhookUpdateBody{URL: "https://b.example.com", Enabled: &enabled},
+	})
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestService_Redeliver(t *testing.T) {
+	repo := &mockRepository{
+		webhooks:   []Webhook{{Id: 1, Enabled: true}, {Id: 2}},
+		deliveries: []Delivery{{Id: 7, WebhookId: 1, Status: DeliveryFailed, Attempts: 10}, {Id: 8, WebhookId: 2, Status: DeliveryFailed}},
+	}
+	svc := NewService(repo, config.WebhookConfig{})
+
+	require.NoError(t, svc.Redeliver(context.Background(), 1, 7))
+	assert.Equal(t, DeliveryPending, repo.deliveries[0].Status)
+	assert.Zero(t, repo.deliveries[0].Attempts)
+
+	assert.ErrorIs(t, svc.Redeliver(context.Background(), 1, 8), ErrNotFound, "the delivery belongs to another webhook")
+	assert.ErrorIs(t, svc.Redeliver(context.Background(), 2, 8), ErrDisabled)
+}
@@ -0,0 +1,127 @@
+package webhook
+
+import (
+	"encoding/json"
+	"test-go/common"
+	"time"
+)
+
+type WebhookCreateBody struct {
+	URL string `json:"url" binding:"required" example:"https://partner.example.com/hooks/customers"`
+	// Events lists the event types to receive, every type when empty.
+	Events []string `json:"events" example:"CustomerCreated,CustomerUpdated"`
+	// Secret signs the deliveries. A random secret is generated when empty.
+	Secret string `json:"secret"`
+}
+
+type WebhookUpdateBody struct {
+	URL    string   `json:"url" binding:"required" example:"https://partner.example.com/hooks/customers"`
+	Events []string `json:"events" example:"CustomerCreated,CustomerUpdated"`
+	// Secret replaces the signing secret when set.
+	Secret string `json:"secret"`
+	// Enabled set to true turns a webhook disabled after failures back on.
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+type WebhookServiceCreateInput struct {
+	WebhookCreateBody
+	CreatedBy string
+}
+
+type WebhookServiceUpdateInput struct {
+	WebhookUpdateBody
+	UpdatedBy string
+}
+
+type WebhookIndexQuery struct {
+	common.PaginationQuery
+}
+
+type WebhookServiceFindAllAndCount struct {
+	Data       []Webhook
+	TotalItems int64
+}
+
+type DeliveryIndexQuery struct {
+	common.PaginationQuery
+}
+
+type WebhookServiceFindDeliveries struct {
+	Data       []Delivery
+	TotalItems int64
+}
+
+type WebhookResponse struct {
+	Id                  uint       `json:"id"`
+	URL                 string     `json:"url"`
+	Events              []string   `json:"events"`
+	Enabled             bool       `json:"enabled"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	DisabledAt          *time.Time `json:"disabledAt"`
+	CreatedAt           time.Time  `json:"createdAt"`
+	CreatedBy           string     `json:"createdBy"`
+	UpdatedAt           time.Time  `json:"updatedAt"`
+	UpdatedBy           string     `json:"updatedBy"`
+}
+
+type WebhookCreateResponse struct {
+	WebhookResponse
+	// Secret is only returned here; store it to verify the signatures.
+	Secret string `json:"secret"`
+}
+
+type DeliveryResponse struct {
+	Id            uint64    `json:"id"`
+	EventId       uint64    `json:"eventId"`
+	EventType     string    `json:"eventType" example:"CustomerCreated"`
+	Status        string    `json:"status" example:"succeeded"`
+	Attempts      int       `json:"attempts"`
+	ResponseCode  *int      `json:"responseCode" example:"200"`
+	LastError     string    `json:"lastError"`
+	NextAttemptAt time.Time `json:"nextAttemptAt"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// Payload is the JSON body of every delivery. Data is the payload of the
+// event, ex. a customer.CustomerEvent for customer events.
+type Payload struct {
+	Id        uint64          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+func toWebhookResponse(w *Webhook) WebhookResponse {
+	events := w.Events
+	if events == nil {
+		events = []string{}
+	}
+	return WebhookResponse{
+		Id:                  w.Id,
+		URL:                 w.URL,
+		Events:              events,
+		Enabled:             w.Enabled,
+		ConsecutiveFailures: w.ConsecutiveFailures,
+		DisabledAt:          w.DisabledAt,
+		CreatedAt:           w.CreatedAt,
+		CreatedBy:           w.CreatedBy,
+		UpdatedAt:           w.UpdatedAt,
+		UpdatedBy:           w.UpdatedBy,
+	}
+}
+
+func toDeliveryResponse(d *Delivery) DeliveryResponse {
+	return DeliveryResponse{
+		Id:            d.Id,
+		EventId:       d.EventId,
+		EventType:     d.EventType,
+		Status:        d.Status,
+		Attempts:      d.Attempts,
+		ResponseCode:  d.ResponseCode,
+		LastError:     d.LastError,
+		NextAttemptAt: d.NextAttemptAt,
+		CreatedAt:     d.CreatedAt,
+		UpdatedAt:     d.UpdatedAt,
+	}
+}
@@ -1,17 +1,35 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"test-go/common"
 	customer "test-go/internal/customer"
 	healthcheck "test-go/internal/health-check"
+	"test-go/internal/webhook"
+	"test-go/migrations"
+	"test-go/pkg/cache"
+	"test-go/pkg/config"
 	database "test-go/pkg/db"
+	"test-go/pkg/logging"
+	"test-go/pkg/metrics"
+	"test-go/pkg/migrate"
+	"test-go/pkg/outbox"
+	"test-go/pkg/pgnotify"
+	"test-go/pkg/tracing"
+	"test-go/pkg/worker"
+	"time"
 
 	_ "test-go/docs"
 
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"gorm.io/gorm"
@@ -21,36 +39,248 @@ import (
 // @version 1.0
 // @BasePath /api/v1
 func main() {
+	cfg, err := config.Load(os.Args[1:], ".env")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	logger := logging.New(os.Stdout, cfg.Logging.Level)
+	slog.SetDefault(logger)
+
+	flushTraces, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("failed to set up tracing", err)
+	}
+
+	db, err := database.ConnectPostgres(cfg.Database)
+	if err != nil {
+		fatal("failed to connect to database", err)
+	}
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		fatal("failed to set up query tracing", err)
+	}
+
+	if cfg.Features.Metrics {
+		if err := setupMetrics(db); err != nil {
+			fatal("failed to set up metrics", err)
+		}
+	}
+
+	var replicas *database.Replicas
+	if len(cfg.Database.Replicas) > 0 {
+		// the read-your-writes window is per principal, which the mock
+		// authentication gives every request
+		replicas, err = database.UseReplicas(db, cfg.Database, common.PrincipalFromContext)
+		if err != nil {
+			fatal("failed to set up read replicas", err)
+		}
+	}
+
+	probes, err := setupProbes(cfg, db)
+	if err != nil {
+		fatal("failed to set up health probes", err)
+	}
+
+	workers := worker.NewGroup()
+	if replicas != nil {
+		workers.Go("replica-lag-check", replicas.Run)
+	}
+	publisher, err := setupOutbox(cfg, db, workers)
+	if err != nil {
+		fatal("failed to set up outbox relay", err)
+	}
+	setupWebhooks(cfg, db, publisher, workers)
+	customerCache := setupCustomerCache(cfg)
+	if customerCache != nil {
+		listener := pgnotify.NewListener(cfg.Database.DSN(), customer.ChangeChannel, cfg.Database.ListenBackoff, cfg.Database.ListenMaxBackoff)
+		customer.InvalidateOnChange(listener, customerCache)
+		workers.Go("customer-change-listener", listener.Run)
+	}
+
+	tail := outbox.NewTail(db, cfg.Stream.PollInterval, cfg.Stream.Buffer)
+	workers.Go("outbox-tail", tail.Run)
+	router := setupRouter(cfg, logger, db, probes, tail, customerCache, replicas)
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Server.Port),
+		Handler:           router,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+	}
+	// end the event streams, which never finish on their own, when draining
+	server.RegisterOnShutdown(tail.Close)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	err := godotenv.Load()
-	db, err := database.ConnectPostgres()
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found or error loading it")
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("server listening", "addr", server.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	select {
+	case err := <-serverErr:
+		fatal("failed to run server", err)
+	case <-ctx.Done():
 	}
 
-	router := setupRouter(db)
+	slog.Info("shutting down server")
+	probes.SetShuttingDown()
+	time.Sleep(cfg.Server.ShutdownDelay)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		log.Fatal("Failed to run server:", err)
+	if err := shutdown(cfg, server, workers, db, replicas, flushTraces); err != nil {
+		fatal("failed to shut down cleanly", err)
 	}
+	slog.Info("server stopped")
+}
 
-	if err := router.Run(":" + port); err != nil {
-		log.Fatal("Failed to run server:", err)
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// shutdown stops accepting connections, drains in-flight requests, stops the
+// background workers, closes the database pools and flushes pending spans, all
+// within the shutdown timeout.
+func shutdown(cfg *config.Config, server *http.Server, workers *worker.Group, db *gorm.DB, replicas *database.Replicas, flushTraces func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	if err := server.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to drain requests: %w", err))
+	}
+	if err := workers.Stop(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		if err := sqlDB.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close database: %w", err))
+		}
+	}
+	if replicas != nil {
+		if err := replicas.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close replicas: %w", err))
+		}
+	}
+	if err := flushTraces(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to flush traces: %w", err))
 	}
+	return errors.Join(errs...)
 }
 
-func setupRouter(db *gorm.DB) *gin.Engine {
+func setupMetrics(db *gorm.DB) error {
+	if err := db.Use(metrics.GormPlugin{}); err != nil {
+		return err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return metrics.RegisterDBStats(sqlDB)
+}
+
+// setupOutbox starts the relay that publishes the outbox events to the
+// returned publisher, when this replica relays them. Every event is also
+// appended to the outbox file when one is configured.
+func setupOutbox(cfg *config.Config, db *gorm.DB, workers *worker.Group) (*outbox.InProcessPublisher, error) {
+	publisher := outbox.NewInProcessPublisher()
+	if !cfg.Outbox.RelayEnabled {
+		return publisher, nil
+	}
+
+	var file *outbox.FilePublisher
+	if cfg.Outbox.File != "" {
+		var err error
+		if file, err = outbox.NewFilePublisher(cfg.Outbox.File); err != nil {
+			return nil, err
+		}
+		publisher.Subscribe(file.Publish)
+	}
+
+	relay := outbox.NewRelay(db, publisher, cfg.Outbox)
+	workers.Go("outbox-relay", func(ctx context.Context) {
+		relay.Run(ctx)
+		if file != nil {
+			file.Close()
+		}
+	})
+	return publisher, nil
+}
+
+// setupWebhooks turns the published events into webhook deliveries and, when
+// this replica sends them, starts the delivery worker.
+func setupWebhooks(cfg *config.Config, db *gorm.DB, publisher *outbox.InProcessPublisher, workers *worker.Group) {
+	repo := webhook.NewRepository(db)
+	publisher.Subscribe(webhook.NewDispatcher(repo).Handle)
+	if cfg.Webhook.DeliveryEnabled {
+		workers.Go("webhook-delivery", webhook.NewWorker(repo, cfg.Webhook).Run)
+	}
+}
+
+// setupCustomerCache returns the cache of customer lookups, or nil when
+// caching is disabled.
+func setupCustomerCache(cfg *config.Config) *customer.RepositoryCache {
+	if cfg.Cache.Backend == config.CacheBackendNone {
+		return nil
+	}
+	return customer.NewRepositoryCache(cache.NewLRU(cfg.Cache.Size), cfg.Cache.TTL, cfg.Cache.NegativeTTL)
+}
+
+func setupProbes(cfg *config.Config, db *gorm.DB) (*healthcheck.Probes, error) {
+	all, err := migrate.Load(migrations.FS)
+	if err != nil {
+		return nil, err
+	}
+	var latest uint64
+	if len(all) > 0 {
+		latest = all[len(all)-1].Version
+	}
+
+	checkers := []healthcheck.Checker{
+		healthcheck.NewDatabaseChecker(db),
+		healthcheck.NewMigrationChecker(db, latest),
+	}
+	if cfg.Health.DiskPath != "" {
+		checkers = append(checkers, healthcheck.NewDiskChecker(cfg.Health.DiskPath, uint64(cfg.Health.DiskMinFreeMB)<<20))
+	}
+
+	return healthcheck.NewProbes(cfg.Health.CheckTimeout, checkers...), nil
+}
+
+func setupRouter(cfg *config.Config, logger *slog.Logger, db *gorm.DB, probes *healthcheck.Probes, tail *outbox.Tail, customerCache *customer.RepositoryCache, replicas *database.Replicas) *gin.Engine {
+	if cfg.Logging.Level != "debug" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
 	r := gin.New()
-	r.Use(gin.Logger(), common.JSONRecovery()) // ใช้ custom recovery
+	r.Use(common.RequestID(logger), tracing.Middleware(), common.AccessLog(), common.JSONRecovery()) // ใช้ custom recovery
+	if cfg.Features.Metrics {
+		r.Use(metrics.HTTPMiddleware())
+		r.GET("/metrics", gin.WrapH(metrics.Handler()))
+	}
 
 	apiV1 := r.Group("/api/v1")
+	apiV1.Use(common.MockAuth(cfg.Auth.MockUser))
+	// event streams stay open, so they are left out of the request timeout
+	customer.NewStreamHandler(tail, cfg.Stream.Heartbeat, customer.AllowAuthenticated).RegisterRoutes(apiV1)
+
+	api := apiV1.Group("", common.Timeout(cfg.Server.RequestTimeout))
 	{
-		customer.RegisterRoutes(apiV1, db)
-		healthcheck.RegisterRoutes(apiV1, db)
+		customer.RegisterRoutes(api, db, customerCache)
+		webhook.RegisterRoutes(api, db, cfg.Webhook)
+		healthcheck.RegisterRoutes(api, db, probes, replicas)
 	}
 
-	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	if cfg.Features.Swagger {
+		r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	}
 
 	return r
 }
@@ -0,0 +1,4 @@
+ALTER TABLE customers
+    ALTER COLUMN is_deleted DROP NOT NULL,
+    ALTER COLUMN created_at DROP NOT NULL,
+    ALTER COLUMN updated_at DROP NOT NULL;
@@ -0,0 +1,8 @@
+UPDATE customers SET is_deleted = FALSE WHERE is_deleted IS NULL;
+UPDATE customers SET created_at = NOW() WHERE created_at IS NULL;
+UPDATE customers SET updated_at = NOW() WHERE updated_at IS NULL;
+
+ALTER TABLE customers
+    ALTER COLUMN is_deleted SET NOT NULL,
+    ALTER COLUMN created_at SET NOT NULL,
+    ALTER COLUMN updated_at SET NOT NULL;
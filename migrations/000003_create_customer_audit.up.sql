@@ -0,0 +1,12 @@
+-- no foreign key to customers: the history of purged customers is kept
+CREATE TABLE IF NOT EXISTS customer_audit (
+    id BIGSERIAL PRIMARY KEY,
+    customer_id INTEGER NOT NULL,
+    action TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    request_id TEXT NOT NULL,
+    changes JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS customer_audit_customer_id_idx ON customer_audit (customer_id, id);
@@ -0,0 +1,24 @@
+-- Every write of a customer closes its open version and opens a new one, so
+-- the version valid at a given instant is the state of the customer then.
+CREATE TABLE IF NOT EXISTS customer_versions (
+    id BIGSERIAL PRIMARY KEY,
+    customer_id INTEGER NOT NULL,
+    name_th TEXT NOT NULL,
+    name_en TEXT NOT NULL,
+    email TEXT NOT NULL,
+    is_deleted BOOLEAN NOT NULL,
+    created_by TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_by TEXT NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    valid_from TIMESTAMPTZ NOT NULL,
+    valid_to TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS customer_versions_customer_id_idx ON customer_versions (customer_id, valid_from);
+
+-- Earlier changes were not recorded, so existing customers get one version
+-- holding their current state since they were created.
+INSERT INTO customer_versions (customer_id, name_th, name_en, email, is_deleted, created_by, created_at, updated_by, updated_at, valid_from)
+SELECT id, name_th, name_en, email, is_deleted, created_by, created_at, updated_by, updated_at, created_at
+FROM customers;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS outbox_tx_idx;
+
+ALTER TABLE outbox DROP COLUMN IF EXISTS tx_id;
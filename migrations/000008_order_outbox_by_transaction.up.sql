@@ -0,0 +1,4 @@
+-- readers follow the events by transaction, below the oldest running one
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS tx_id BIGINT NOT NULL DEFAULT pg_current_xact_id()::text::bigint;
+
+CREATE INDEX IF NOT EXISTS outbox_tx_idx ON outbox (tx_id, id);
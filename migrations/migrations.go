@@ -0,0 +1,12 @@
+// Package migrations holds the schema and data migrations of the service.
+//
+// SQL migrations live next to this file as NNNNNN_name.up.sql / .down.sql.
+// Migrations that cannot be written in plain SQL are Go files in this package
+// that call migrate.Register from an init function with their own version,
+// so they run interleaved with the SQL files.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
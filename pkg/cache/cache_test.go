@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRU_EvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(2)
+	c.Set(ctx, "a", []byte("1"), time.Minute)
+	c.Set(ctx, "b", []byte("2"), time.Minute)
+	c.Get(ctx, "a")
+	c.Set(ctx, "c", []byte("3"), time.Minute)
+
+	_, ok, _ := c.Get(ctx, "b")
+	assert.False(t, ok, "b was used least recently")
+	value, ok, _ := c.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), value)
+	assert.Equal(t, 2, c.Len())
+}
+
+func TestLRU_ExpiresEntries(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	c := NewLRU(10)
+	c.now = func() time.Time { return now }
+
+	c.Set(ctx, "a", []byte("1"), time.Second)
+	_, ok, _ := c.Get(ctx, "a")
+	assert.True(t, ok)
+
+	now = now.Add(time.Second)
+	_, ok, _ = c.Get(ctx, "a")
+	assert.False(t, ok)
+	assert.Zero(t, c.Len(), "expired entries are removed when read")
+}
+
+func TestLRU_DeleteAndClear(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(10)
+	for _, key := range []string{"a", "b", "c"} {
+		c.Set(ctx, key, []byte(key), time.Minute)
+	}
+
+	c.Delete(ctx, "a", "missing")
+	_, ok, _ := c.Get(ctx, "a")
+	assert.False(t, ok)
+	assert.Equal(t, 2, c.Len())
+
+	c.Clear(ctx)
+	assert.Zero(t, c.Len())
+}
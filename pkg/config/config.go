@@ -0,0 +1,505 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Config is the whole application configuration. Each setting can come from
+// the YAML file (yaml tag), an environment variable (env tag) or a flag (flag tag).
+type Config struct {
+	Env      string         `yaml:"env" env:"APP_ENV" flag:"env"`
+	Server   ServerConfig   `yaml:"server"`
+	Database DatabaseConfig `yaml:"database"`
+	Auth     AuthConfig     `yaml:"auth"`
+	Logging  LoggingConfig  `yaml:"logging"`
+	Features FeaturesConfig `yaml:"features"`
+	Health   HealthConfig   `yaml:"health"`
+	Export   ExportConfig   `yaml:"export"`
+	Tracing  TracingConfig  `yaml:"tracing"`
+	Outbox   OutboxConfig   `yaml:"outbox"`
+	Webhook  WebhookConfig  `yaml:"webhook"`
+	Stream   StreamConfig   `yaml:"stream"`
+	Cache    CacheConfig    `yaml:"cache"`
+}
+
+type ServerConfig struct {
+	Port int `yaml:"port" env:"PORT" flag:"port"`
+
+	ReadTimeout       time.Duration `yaml:"readTimeout" env:"SERVER_READ_TIMEOUT"`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout" env:"SERVER_READ_HEADER_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"writeTimeout" env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `yaml:"idleTimeout" env:"SERVER_IDLE_TIMEOUT"`
+	MaxHeaderBytes    int           `yaml:"maxHeaderBytes" env:"SERVER_MAX_HEADER_BYTES"`
+
+	// RequestTimeout bounds the API handlers and the queries they run; requests
+	// that exceed it are answered 504.
+	RequestTimeout time.Duration `yaml:"requestTimeout" env:"SERVER_REQUEST_TIMEOUT"`
+
+	// ShutdownDelay keeps serving, with readiness failing, before draining so
+	// load balancers notice the replica is going away.
+	ShutdownDelay time.Duration `yaml:"shutdownDelay" env:"SERVER_SHUTDOWN_DELAY"`
+	// ShutdownTimeout bounds how long in-flight requests and workers may take to finish on shutdown.
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout" env:"SERVER_SHUTDOWN_TIMEOUT"`
+}
+
+type DatabaseConfig struct {
+	Host     string `yaml:"host" env:"DB_HOST" flag:"db-host"`
+	Port     int    `yaml:"port" env:"DB_PORT" flag:"db-port"`
+	User     string `yaml:"user" env:"DB_USER" flag:"db-user"`
+	Password string `yaml:"password" env:"DB_PASSWORD"`
+	Name     string `yaml:"name" env:"DB_NAME" flag:"db-name"`
+
+	SSLMode     string `yaml:"sslMode" env:"DB_SSLMODE" flag:"db-sslmode"`
+	SSLRootCert string `yaml:"sslRootCert" env:"DB_SSLROOTCERT"`
+
+	MaxOpenConns    int           `yaml:"maxOpenConns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"maxIdleConns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"connMaxLifetime" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `yaml:"connMaxIdleTime" env:"DB_CONN_MAX_IDLE_TIME"`
+
+	ConnectTimeout   time.Duration `yaml:"connectTimeout" env:"DB_CONNECT_TIMEOUT"`
+	StatementTimeout time.Duration `yaml:"statementTimeout" env:"DB_STATEMENT_TIMEOUT"`
+
+	// The startup ping is retried PingRetries times, doubling PingBackoff after every attempt.
+	PingRetries int           `yaml:"pingRetries" env:"DB_PING_RETRIES"`
+	PingBackoff time.Duration `yaml:"pingBackoff" env:"DB_PING_BACKOFF"`
+
+	// Queries slower than SlowQueryThreshold are logged with their caller.
+	SlowQueryThreshold time.Duration `yaml:"slowQueryThreshold" env:"DB_SLOW_QUERY_THRESHOLD"`
+	// ExplainSlowQueries logs the EXPLAIN (ANALYZE, BUFFERS) plan of slow customer
+	// listings. It runs the query a second time, so it is refused in production.
+	ExplainSlowQueries bool `yaml:"explainSlowQueries" env:"DB_EXPLAIN_SLOW_QUERIES"`
+
+	// The connection listening for change notifications reconnects after
+	// ListenBackoff, doubled after every further failure up to ListenMaxBackoff.
+	ListenBackoff    time.Duration `yaml:"listenBackoff" env:"DB_LISTEN_BACKOFF"`
+	ListenMaxBackoff time.Duration `yaml:"listenMaxBackoff" env:"DB_LISTEN_MAX_BACKOFF"`
+
+	// Replicas are the DSNs of read replicas, comma separated in DB_REPLICAS.
+	// The API reads from them outside transactions; everything else uses the primary.
+	Replicas []string `yaml:"replicas" env:"DB_REPLICAS"`
+	// A replica lagging more than ReplicaMaxLag, or failing its lag check, is
+	// not read from until a later check, run every ReplicaCheckInterval, passes.
+	ReplicaMaxLag        time.Duration `yaml:"replicaMaxLag" env:"DB_REPLICA_MAX_LAG"`
+	ReplicaCheckInterval time.Duration `yaml:"replicaCheckInterval" env:"DB_REPLICA_CHECK_INTERVAL"`
+	// ReadYourWritesWindow sends the reads of a principal to the primary for that
+	// long after it wrote, so it reads its own changes back. Zero disables it.
+	// The writes are kept in the memory of each API replica, so clients must
+	// stick to one, and every request shares the principal of the mock
+	// authentication.
+	ReadYourWritesWindow time.Duration `yaml:"readYourWritesWindow" env:"DB_READ_YOUR_WRITES_WINDOW"`
+}
+
+type AuthConfig struct {
+	// MockUser is the principal of every request until token decoding is in place.
+	MockUser string `yaml:"mockUser" env:"AUTH_MOCK_USER" flag:"auth-mock-user"`
+}
+
+type LoggingConfig struct {
+	Level string `yaml:"level" env:"LOG_LEVEL" flag:"log-level"`
+}
+
+type FeaturesConfig struct {
+	Swagger bool `yaml:"swagger" env:"FEATURE_SWAGGER" flag:"feature-swagger"`
+	Metrics bool `yaml:"metrics" env:"FEATURE_METRICS" flag:"feature-metrics"`
+}
+
+type HealthConfig struct {
+	CheckTimeout time.Duration `yaml:"checkTimeout" env:"HEALTH_CHECK_TIMEOUT"`
+	// DiskPath enables the free disk space check for local storage when set.
+	DiskPath      string `yaml:"diskPath" env:"HEALTH_DISK_PATH"`
+	DiskMinFreeMB int    `yaml:"diskMinFreeMB" env:"HEALTH_DISK_MIN_FREE_MB"`
+}
+
+type ExportConfig struct {
+	AnonymizeKey string `yaml:"anonymizeKey" env:"ANONYMIZE_KEY"`
+}
+
+type TracingConfig struct {
+	// Exporter is one of none, otlp (OTLP over HTTP to OTLPEndpoint), stdout or file (JSON spans appended to File).
+	Exporter     string `yaml:"exporter" env:"TRACING_EXPORTER" flag:"tracing-exporter"`
+	ServiceName  string `yaml:"serviceName" env:"TRACING_SERVICE_NAME"`
+	OTLPEndpoint string `yaml:"otlpEndpoint" env:"TRACING_OTLP_ENDPOINT"`
+	OTLPInsecure bool   `yaml:"otlpInsecure" env:"TRACING_OTLP_INSECURE"`
+	File         string `yaml:"file" env:"TRACING_FILE"`
+}
+
+type OutboxConfig struct {
+	// RelayEnabled publishes the outbox events from this replica. Events are
+	// recorded either way.
+	RelayEnabled bool `yaml:"relayEnabled" env:"OUTBOX_RELAY_ENABLED" flag:"outbox-relay"`
+	// File, when set, appends every published event to it as a JSON line.
+	File         string        `yaml:"file" env:"OUTBOX_FILE"`
+	PollInterval time.Duration `yaml:"pollInterval" env:"OUTBOX_POLL_INTERVAL"`
+	BatchSize    int           `yaml:"batchSize" env:"OUTBOX_BATCH_SIZE"`
+	// A failed publish is retried after twice the previous wait, up to MaxBackoff.
+	MaxBackoff time.Duration `yaml:"maxBackoff" env:"OUTBOX_MAX_BACKOFF"`
+	// An event failing MaxAttempts times is parked and no longer published.
+	MaxAttempts int `yaml:"maxAttempts" env:"OUTBOX_MAX_ATTEMPTS"`
+}
+
+type WebhookConfig struct {
+	// DeliveryEnabled sends the webhook deliveries from this replica.
+	DeliveryEnabled bool          `yaml:"deliveryEnabled" env:"WEBHOOK_DELIVERY_ENABLED" flag:"webhook-delivery"`
+	PollInterval    time.Duration `yaml:"pollInterval" env:"WEBHOOK_POLL_INTERVAL"`
+	BatchSize       int           `yaml:"batchSize" env:"WEBHOOK_BATCH_SIZE"`
+	// Timeout bounds one attempt, from connecting to reading the response.
+	Timeout time.Duration `yaml:"timeout" env:"WEBHOOK_TIMEOUT"`
+	// A failed attempt is retried after BaseBackoff, doubled after every
+	// further failure up to MaxBackoff, until MaxAttempts were made.
+	MaxAttempts int           `yaml:"maxAttempts" env:"WEBHOOK_MAX_ATTEMPTS"`
+	BaseBackoff time.Duration `yaml:"baseBackoff" env:"WEBHOOK_BASE_BACKOFF"`
+	MaxBackoff  time.Duration `yaml:"maxBackoff" env:"WEBHOOK_MAX_BACKOFF"`
+	// DisableAfter disables a webhook after that many failed attempts in a row.
+	DisableAfter int `yaml:"disableAfter" env:"WEBHOOK_DISABLE_AFTER"`
+	// AllowPrivateNetworks lets webhooks target loopback, private and
+	// link-local addresses, for local development only.
+	AllowPrivateNetworks bool `yaml:"allowPrivateNetworks" env:"WEBHOOK_ALLOW_PRIVATE_NETWORKS"`
+}
+
+type StreamConfig struct {
+	// PollInterval is how often each replica reads new outbox events for its streams.
+	PollInterval time.Duration `yaml:"pollInterval" env:"STREAM_POLL_INTERVAL"`
+	// Heartbeat is the interval of the comments keeping idle streams open through proxies.
+	Heartbeat time.Duration `yaml:"heartbeat" env:"STREAM_HEARTBEAT"`
+	// Buffer is how many events a connection may fall behind before it is
+	// closed; the client then resumes with Last-Event-ID.
+	Buffer int `yaml:"buffer" env:"STREAM_BUFFER"`
+}
+
+type CacheConfig struct {
+	// Backend is none (no caching) or memory (an LRU of Size entries per replica).
+	Backend string `yaml:"backend" env:"CACHE_BACKEND"`
+	Size    int    `yaml:"size" env:"CACHE_SIZE"`
+	// TTL is how long a customer is cached, and NegativeTTL how long a miss is.
+	TTL         time.Duration `yaml:"ttl" env:"CACHE_TTL"`
+	NegativeTTL time.Duration `yaml:"negativeTTL" env:"CACHE_NEGATIVE_TTL"`
+}
+
+const (
+	CacheBackendNone   = "none"
+	CacheBackendMemory = "memory"
+)
+
+var cacheBackends = []string{CacheBackendNone, CacheBackendMemory}
+
+const (
+	TracingExporterNone   = "none"
+	TracingExporterOTLP   = "otlp"
+	TracingExporterStdout = "stdout"
+	TracingExporterFile   = "file"
+)
+
+var tracingExporters = []string{TracingExporterNone, TracingExporterOTLP, TracingExporterStdout, TracingExporterFile}
+
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+)
+
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+func Default() *Config {
+	return &Config{
+		Env: EnvDevelopment,
+		Server: ServerConfig{
+			Port:              3000,
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			MaxHeaderBytes:    1 << 20,
+			RequestTimeout:    10 * time.Second,
+			ShutdownTimeout:   20 * time.Second,
+		},
+		Database: DatabaseConfig{
+			Host:             "localhost",
+			Port:             5432,
+			SSLMode:          "disable",
+			MaxOpenConns:     25,
+			MaxIdleConns:     5,
+			ConnMaxLifetime:  30 * time.Minute,
+			ConnMaxIdleTime:  5 * time.Minute,
+			ConnectTimeout:   5 * time.Second,
+			StatementTimeout: 30 * time.Second,
+			PingRetries:      10,
+			PingBackoff:      500 * time.Millisecond,
+
+			SlowQueryThreshold: 200 * time.Millisecond,
+			ListenBackoff:      time.Second,
+			ListenMaxBackoff:   30 * time.Second,
+
+			ReplicaMaxLag:        5 * time.Second,
+			ReplicaCheckInterval: 5 * time.Second,
+			ReadYourWritesWindow: 5 * time.Second,
+		},
+		Auth: AuthConfig{
+			MockUser: "email@mock.com",
+		},
+		Logging: LoggingConfig{
+			Level: "info",
+		},
+		Features: FeaturesConfig{
+			Swagger: true,
+			Metrics: true,
+		},
+		Health: HealthConfig{
+			CheckTimeout:  2 * time.Second,
+			DiskMinFreeMB: 100,
+		},
+		Tracing: TracingConfig{
+			Exporter:     TracingExporterNone,
+			ServiceName:  "backend-go-api",
+			OTLPEndpoint: "http://localhost:4318",
+			OTLPInsecure: true,
+		},
+		Outbox: OutboxConfig{
+			RelayEnabled: true,
+			PollInterval: time.Second,
+			BatchSize:    100,
+			MaxBackoff:   time.Minute,
+			MaxAttempts:  10,
+		},
+		Webhook: WebhookConfig{
+			DeliveryEnabled: true,
+			PollInterval:    time.Second,
+			BatchSize:       20,
+			Timeout:         10 * time.Second,
+			MaxAttempts:     10,
+			BaseBackoff:     10 * time.Second,
+			MaxBackoff:      time.Hour,
+			DisableAfter:    20,
+		},
+		Stream: StreamConfig{
+			PollInterval: time.Second,
+			Heartbeat:    15 * time.Second,
+			Buffer:       256,
+		},
+		Cache: CacheConfig{
+			Backend:     CacheBackendMemory,
+			Size:        10000,
+			TTL:         5 * time.Minute,
+			NegativeTTL: 30 * time.Second,
+		},
+	}
+}
+
+// Validate reports every invalid setting, joined into one error.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Env == "" {
+		errs = append(errs, errors.New("env: must not be empty"))
+	}
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("server.port: %d is not a valid port", c.Server.Port))
+	}
+	if c.Server.ReadTimeout <= 0 || c.Server.ReadHeaderTimeout <= 0 || c.Server.WriteTimeout <= 0 || c.Server.IdleTimeout <= 0 {
+		errs = append(errs, errors.New("server: read, read header, write and idle timeouts must be positive"))
+	}
+	if c.Server.RequestTimeout <= 0 || c.Server.RequestTimeout >= c.Server.WriteTimeout {
+		errs = append(errs, errors.New("server.requestTimeout: must be positive and shorter than server.writeTimeout"))
+	}
+	if c.Server.MaxHeaderBytes < 1 {
+		errs = append(errs, errors.New("server.maxHeaderBytes: must be at least 1"))
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("server.shutdownTimeout: must be positive"))
+	}
+	if c.Server.ShutdownDelay < 0 {
+		errs = append(errs, errors.New("server.shutdownDelay: must not be negative"))
+	}
+	if c.Health.CheckTimeout <= 0 {
+		errs = append(errs, errors.New("health.checkTimeout: must be positive"))
+	}
+	if c.Health.DiskMinFreeMB < 0 {
+		errs = append(errs, errors.New("health.diskMinFreeMB: must not be negative"))
+	}
+	errs = append(errs, c.Database.validate())
+	if c.IsProduction() && c.Database.ExplainSlowQueries {
+		errs = append(errs, errors.New("database.explainSlowQueries: must not be enabled in production"))
+	}
+	if c.Auth.MockUser == "" {
+		errs = append(errs, errors.New("auth.mockUser: must not be empty"))
+	}
+	if !slices.Contains(logLevels, c.Logging.Level) {
+		errs = append(errs, fmt.Errorf("logging.level: %q must be one of %v", c.Logging.Level, logLevels))
+	}
+	errs = append(errs, c.Tracing.validate())
+	errs = append(errs, c.Outbox.validate())
+	errs = append(errs, c.Webhook.validate())
+	if c.Stream.PollInterval <= 0 || c.Stream.Heartbeat <= 0 {
+		errs = append(errs, errors.New("stream: poll interval and heartbeat must be positive"))
+	}
+	if c.Stream.Buffer < 1 {
+		errs = append(errs, errors.New("stream.buffer: must be at least 1"))
+	}
+	errs = append(errs, c.Cache.validate())
+
+	return errors.Join(errs...)
+}
+
+func (c *Config) IsProduction() bool {
+	return c.Env == EnvProduction
+}
+
+func (c CacheConfig) validate() error {
+	if !slices.Contains(cacheBackends, c.Backend) {
+		return fmt.Errorf("cache.backend: %q must be one of %v", c.Backend, cacheBackends)
+	}
+	if c.Backend == CacheBackendNone {
+		return nil
+	}
+	var errs []error
+	if c.Size < 1 {
+		errs = append(errs, errors.New("cache.size: must be at least 1"))
+	}
+	if c.TTL <= 0 || c.NegativeTTL <= 0 {
+		errs = append(errs, errors.New("cache: ttl and negative ttl must be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+func (d DatabaseConfig) validate() error {
+	var errs []error
+	if d.Host == "" {
+		errs = append(errs, errors.New("database.host: must not be empty"))
+	}
+	if d.Port < 1 || d.Port > 65535 {
+		errs = append(errs, fmt.Errorf("database.port: %d is not a valid port", d.Port))
+	}
+	if d.User == "" {
+		errs = append(errs, errors.New("database.user: must not be empty"))
+	}
+	if d.Password == "" {
+		errs = append(errs, errors.New("database.password: must not be empty"))
+	}
+	if d.Name == "" {
+		errs = append(errs, errors.New("database.name: must not be empty"))
+	}
+	if !slices.Contains(sslModes, d.SSLMode) {
+		errs = append(errs, fmt.Errorf("database.sslMode: %q must be one of %v", d.SSLMode, sslModes))
+	}
+	if d.MaxOpenConns < 1 {
+		errs = append(errs, errors.New("database.maxOpenConns: must be at least 1"))
+	}
+	if d.MaxIdleConns < 0 || d.MaxIdleConns > d.MaxOpenConns {
+		errs = append(errs, fmt.Errorf("database.maxIdleConns: must be between 0 and maxOpenConns (%d)", d.MaxOpenConns))
+	}
+	if d.ConnectTimeout > 0 && d.ConnectTimeout < time.Second {
+		errs = append(errs, errors.New("database.connectTimeout: must be at least 1s"))
+	}
+	if d.StatementTimeout < 0 {
+		errs = append(errs, errors.New("database.statementTimeout: must not be negative"))
+	}
+	if d.PingRetries < 0 {
+		errs = append(errs, errors.New("database.pingRetries: must not be negative"))
+	}
+	if d.SlowQueryThreshold <= 0 {
+		errs = append(errs, errors.New("database.slowQueryThreshold: must be positive"))
+	}
+	if d.ListenBackoff <= 0 || d.ListenMaxBackoff < d.ListenBackoff {
+		errs = append(errs, errors.New("database.listenBackoff: must be positive and not longer than database.listenMaxBackoff"))
+	}
+	if slices.Contains(d.Replicas, "") {
+		errs = append(errs, errors.New("database.replicas: must not contain empty DSNs"))
+	}
+	if d.ReplicaMaxLag <= 0 || d.ReplicaCheckInterval <= 0 {
+		errs = append(errs, errors.New("database: replica max lag and check interval must be positive"))
+	}
+	if d.ReadYourWritesWindow < 0 {
+		errs = append(errs, errors.New("database.readYourWritesWindow: must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+func (t TracingConfig) validate() error {
+	var errs []error
+	if !slices.Contains(tracingExporters, t.Exporter) {
+		errs = append(errs, fmt.Errorf("tracing.exporter: %q must be one of %v", t.Exporter, tracingExporters))
+	}
+	if t.ServiceName == "" {
+		errs = append(errs, errors.New("tracing.serviceName: must not be empty"))
+	}
+	if t.Exporter == TracingExporterOTLP && t.OTLPEndpoint == "" {
+		errs = append(errs, errors.New("tracing.otlpEndpoint: must not be empty with the otlp exporter"))
+	}
+	if t.Exporter == TracingExporterFile && t.File == "" {
+		errs = append(errs, errors.New("tracing.file: must not be empty with the file exporter"))
+	}
+	return errors.Join(errs...)
+}
+
+func (o OutboxConfig) validate() error {
+	var errs []error
+	if o.PollInterval <= 0 {
+		errs = append(errs, errors.New("outbox.pollInterval: must be positive"))
+	}
+	if o.BatchSize < 1 {
+		errs = append(errs, errors.New("outbox.batchSize: must be at least 1"))
+	}
+	if o.MaxBackoff < o.PollInterval {
+		errs = append(errs, errors.New("outbox.maxBackoff: must not be shorter than outbox.pollInterval"))
+	}
+	if o.MaxAttempts < 1 {
+		errs = append(errs, errors.New("outbox.maxAttempts: must be at least 1"))
+	}
+	return errors.Join(errs...)
+}
+
+func (w WebhookConfig) validate() error {
+	var errs []error
+	if w.PollInterval <= 0 || w.Timeout <= 0 || w.BaseBackoff <= 0 {
+		errs = append(errs, errors.New("webhook: poll interval, timeout and base backoff must be positive"))
+	}
+	if w.BatchSize < 1 {
+		errs = append(errs, errors.New("webhook.batchSize: must be at least 1"))
+	}
+	if w.MaxAttempts < 1 {
+		errs = append(errs, errors.New("webhook.maxAttempts: must be at least 1"))
+	}
+	if w.MaxBackoff < w.BaseBackoff {
+		errs = append(errs, errors.New("webhook.maxBackoff: must not be shorter than webhook.baseBackoff"))
+	}
+	if w.DisableAfter < 1 {
+		errs = append(errs, errors.New("webhook.disableAfter: must be at least 1"))
+	}
+	return errors.Join(errs...)
+}
+
+// DSN returns the connection string of the configured database. The
+// statement timeout is sent as a runtime parameter of every connection.
+func (d DatabaseConfig) DSN() string {
+	parts := []string{
+		"host=" + quoteDSNValue(d.Host),
+		"user=" + quoteDSNValue(d.User),
+		"password=" + quoteDSNValue(d.Password),
+		"dbname=" + quoteDSNValue(d.Name),
+		fmt.Sprintf("port=%d", d.Port),
+		"sslmode=" + quoteDSNValue(d.SSLMode),
+	}
+	if d.SSLRootCert != "" {
+		parts = append(parts, "sslrootcert="+quoteDSNValue(d.SSLRootCert))
+	}
+	if d.ConnectTimeout > 0 {
+		parts = append(parts, fmt.Sprintf("connect_timeout=%d", int(d.ConnectTimeout.Seconds())))
+	}
+	if d.StatementTimeout > 0 {
+		parts = append(parts, fmt.Sprintf("statement_timeout=%d", d.StatementTimeout.Milliseconds()))
+	}
+	return strings.Join(parts, " ")
+}
+
+// quoteDSNValue quotes value for a keyword/value connection string, escaping
+// its quotes and backslashes, so it may hold spaces and any other character.
+func quoteDSNValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func setRequiredDatabaseEnv(t *testing.T) {
+	t.Setenv("DB_USER", "postgres")
+	t.Setenv("DB_PASSWORD", "secret")
+	t.Setenv("DB_NAME", "app")
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	setRequiredDatabaseEnv(t)
+
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(file, []byte("server:\n  port: 4000\ndatabase:\n  host: yaml-host\nlogging:\n  level: warn\n"), 0o600)
+	assert.NoError(t, err)
+
+	t.Setenv("DB_HOST", "env-host")
+	t.Setenv("LOG_LEVEL", "error")
+
+	cfg, err := Load([]string{"-config", file, "-log-level", "debug"}, "")
+	assert.NoError(t, err)
+
+	assert.Equal(t, 4000, cfg.Server.Port)         // yaml over default
+	assert.Equal(t, "env-host", cfg.Database.Host) // env over yaml
+	assert.Equal(t, "debug", cfg.Logging.Level)    // flag over env
+	assert.Equal(t, 5432, cfg.Database.Port)       // default
+	assert.Equal(t, "email@mock.com", cfg.Auth.MockUser)
+}
+
+func TestLoad_ReportsEveryError(t *testing.T) {
+	t.Setenv("DB_USER", "")
+	t.Setenv("DB_PASSWORD", "")
+	t.Setenv("DB_NAME", "")
+	t.Setenv("PORT", "abc")
+	t.Setenv("LOG_LEVEL", "verbose")
+
+	_, err := Load(nil, "")
+	assert.Error(t, err)
+	for _, expected := range []string{"PORT", "database.user", "database.password", "database.name", "logging.level"} {
+		assert.Contains(t, err.Error(), expected)
+	}
+}
+
+func TestLoad_ListsAreCommaSeparated(t *testing.T) {
+	setRequiredDatabaseEnv(t)
+	t.Setenv("DB_REPLICAS", "host=replica-1 dbname=app, host=replica-2 dbname=app,")
+
+	cfg, err := Load(nil, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"host=replica-1 dbname=app", "host=replica-2 dbname=app"}, cfg.Database.Replicas)
+}
+
+func TestDatabaseConfig_DSNQuotesValues(t *testing.T) {
+	cfg := Default().Database
+	cfg.User = "app user"
+	cfg.Password = `p@ss w'rd\1 sslmode=disable`
+	cfg.Name = "app"
+	cfg.ConnectTimeout = 0
+	cfg.StatementTimeout = 0
+
+	connConfig, err := pgx.ParseConfig(cfg.DSN())
+	assert.NoError(t, err)
+	assert.Equal(t, "app user", connConfig.User)
+	assert.Equal(t, `p@ss w'rd\1 sslmode=disable`, connConfig.Password)
+	assert.Equal(t, "app", connConfig.Database)
+
+	_, err = pq.NewConnector(cfg.DSN())
+	assert.NoError(t, err, "lib/pq, used by the migrate command, reads it too")
+}
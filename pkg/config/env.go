@@ -1,50 +1,140 @@
 package config
 
 import (
-	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+	"gopkg.in/yaml.v3"
 )
 
-type DBConfig struct {
-	User string
-	Pass string
-	Host string
-	Port string
-	Name string
-}
+// Load builds the configuration with the following precedence, lowest first:
+// defaults, the YAML file named by -config or CONFIG_FILE, environment
+// variables (including those from envFile when it exists) and flags in args.
+// The result is validated and every problem is reported at once.
+func Load(args []string, envFile string) (*Config, error) {
+	if envFile != "" {
+		if err := godotenv.Load(envFile); err != nil {
+			slog.Warn("no env file found or error loading it", "file", envFile)
+		}
+	}
 
-func LoadEnv() DBConfig {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
+	cfg := Default()
+
+	flags := flag.NewFlagSet("config", flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML configuration file")
+	flagValues := map[string]*string{}
+	for _, b := range bindings(cfg) {
+		if b.flag != "" {
+			flagValues[b.flag] = flags.String(b.flag, "", fmt.Sprintf("overrides %s", b.env))
+		}
 	}
-	return DBConfig{
-		User: os.Getenv("DB_USER"),
-		Pass: os.Getenv("DB_PASSWORD"),
-		Host: os.Getenv("DB_HOST"),
-		Port: os.Getenv("DB_PORT"),
-		Name: os.Getenv("DB_NAME"),
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configFile != "" {
+		data, err := os.ReadFile(*configFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", *configFile, err)
+		}
+	}
+
+	var errs []error
+	for _, b := range bindings(cfg) {
+		if value, ok := os.LookupEnv(b.env); ok {
+			if err := set(b.value, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", b.env, err))
+			}
+		}
 	}
-}
 
-func ConnectDB(cfg DBConfig) *sql.DB {
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
-		cfg.User, cfg.Pass, cfg.Host, cfg.Port, cfg.Name)
+	setFlags := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+	for _, b := range bindings(cfg) {
+		if setFlags[b.flag] {
+			if err := set(b.value, *flagValues[b.flag]); err != nil {
+				errs = append(errs, fmt.Errorf("-%s: %w", b.flag, err))
+			}
+		}
+	}
 
-	db, err := sql.Open("postgres", dsn)
-	if err != nil {
-		log.Fatal("Failed to connect to DB:", err)
+	if err := errors.Join(append(errs, cfg.Validate())...); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
 	}
+	return cfg, nil
+}
 
-	err = db.Ping()
-	if err != nil {
-		log.Fatal("Failed to ping DB:", err)
+type binding struct {
+	env   string
+	flag  string
+	value reflect.Value
+}
+
+// bindings lists the settings of cfg that carry an env or flag tag.
+func bindings(cfg *Config) []binding {
+	var result []binding
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(time.Duration(0)) {
+				walk(v.Field(i))
+				continue
+			}
+			env, flagName := field.Tag.Get("env"), field.Tag.Get("flag")
+			if env != "" || flagName != "" {
+				result = append(result, binding{env: env, flag: flagName, value: v.Field(i)})
+			}
+		}
 	}
+	walk(reflect.ValueOf(cfg).Elem())
+	return result
+}
 
-	return db
+func set(v reflect.Value, raw string) error {
+	switch {
+	case v.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", raw)
+		}
+		v.SetInt(int64(n))
+	case v.Type() == reflect.TypeOf([]string(nil)):
+		// lists are comma separated; an empty value is an empty list
+		var values []string
+		for _, value := range strings.Split(raw, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+		v.Set(reflect.ValueOf(values))
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", raw)
+		}
+		v.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
 }
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"test-go/pkg/logging"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/utils"
+)
+
+type explainKey struct{}
+
+// ExplainIfSlow marks the queries run with ctx as worth a query plan: when
+// plan capture is enabled and one of them is slow, its plan is logged.
+func ExplainIfSlow(ctx context.Context) context.Context {
+	return context.WithValue(ctx, explainKey{}, true)
+}
+
+// queryLogger sends gorm logs to the slog logger of the query context, so
+// database errors carry the request id of the request that caused them.
+type queryLogger struct {
+	level     logger.LogLevel
+	threshold time.Duration
+	// explain returns the plan of a query. It is only set when slow query
+	// plans are captured.
+	explain func(ctx context.Context, query string) (string, error)
+}
+
+func newQueryLogger(threshold time.Duration) *queryLogger {
+	return &queryLogger{level: logger.Warn, threshold: threshold}
+}
+
+func (l *queryLogger) LogMode(level logger.LogLevel) logger.Interface {
+	mode := *l
+	mode.level = level
+	return &mode
+}
+
+func (l *queryLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Info {
+		logging.FromContext(ctx).InfoContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l *queryLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Warn {
+		logging.FromContext(ctx).WarnContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l *queryLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Error {
+		logging.FromContext(ctx).ErrorContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l *queryLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if l.level <= logger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && l.level >= logger.Error:
+		sql, rows := fc()
+		logging.FromContext(ctx).LogAttrs(ctx, slog.LevelError, "query failed",
+			slog.String("error", err.Error()), slog.String("sql", sql), slog.Int64("rows", rows), durationAttr(elapsed),
+			slog.String("caller", utils.FileWithLineNum()))
+	case elapsed > l.threshold && l.level >= logger.Warn:
+		sql, rows := fc()
+		attrs := []slog.Attr{
+			slog.String("sql", sql), slog.Int64("rows", rows), durationAttr(elapsed),
+			slog.Float64("threshold_ms", float64(l.threshold.Microseconds())/1000),
+			slog.String("caller", utils.FileWithLineNum()),
+		}
+		if plan, ok := l.plan(ctx, sql); ok {
+			attrs = append(attrs, slog.String("plan", plan))
+		}
+		logging.FromContext(ctx).LogAttrs(ctx, slog.LevelWarn, "slow query", attrs...)
+	case l.level >= logger.Info:
+		sql, rows := fc()
+		logging.FromContext(ctx).LogAttrs(ctx, slog.LevelDebug, "query",
+			slog.String("sql", sql), slog.Int64("rows", rows), durationAttr(elapsed))
+	}
+}
+
+// plan explains query when plan capture is enabled and ctx asked for it.
+// Only SELECTs are explained, since EXPLAIN ANALYZE runs the statement again.
+// Literals are removed from the plan like from logged SQL.
+func (l *queryLogger) plan(ctx context.Context, query string) (string, bool) {
+	if l.explain == nil || ctx.Value(explainKey{}) == nil {
+		return "", false
+	}
+	if !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(query)), "SELECT") {
+		return "", false
+	}
+
+	plan, err := l.explain(ctx, query)
+	if err != nil {
+		logging.FromContext(ctx).WarnContext(ctx, "failed to explain slow query", "error", err)
+		return "", false
+	}
+	return logging.RedactSQL(plan), true
+}
+
+// explainAnalyze runs EXPLAIN (ANALYZE, BUFFERS) on the pool directly, so the
+// plan query is not logged or traced itself.
+func explainAnalyze(db *sql.DB) func(ctx context.Context, query string) (string, error) {
+	return func(ctx context.Context, query string) (string, error) {
+		rows, err := db.QueryContext(ctx, "EXPLAIN (ANALYZE, BUFFERS) "+query)
+		if err != nil {
+			return "", err
+		}
+		defer rows.Close()
+
+		var lines []string
+		for rows.Next() {
+			var line string
+			if err := rows.Scan(&line); err != nil {
+				return "", err
+			}
+			lines = append(lines, line)
+		}
+		return strings.Join(lines, "\n"), rows.Err()
+	}
+}
+
+func durationAttr(d time.Duration) slog.Attr {
+	return slog.Float64("duration_ms", float64(d.Microseconds())/1000)
+}
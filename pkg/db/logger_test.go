@@ -0,0 +1,60 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"test-go/pkg/logging"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func traceSlowQuery(t *testing.T, l *queryLogger, ctx context.Context, sql string) map[string]interface{} {
+	var buf bytes.Buffer
+	ctx = logging.WithLogger(ctx, logging.New(&buf, "debug"))
+
+	l.Trace(ctx, time.Now().Add(-50*time.Millisecond), func() (string, int64) { return sql, 3 }, nil)
+
+	var line map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	return line
+}
+
+func TestQueryLogger_LogsSlowQueries(t *testing.T) {
+	l := newQueryLogger(10 * time.Millisecond)
+
+	line := traceSlowQuery(t, l, context.Background(), "SELECT * FROM customers")
+	assert.Equal(t, "slow query", line["msg"])
+	assert.Equal(t, float64(3), line["rows"])
+	assert.Equal(t, float64(10), line["threshold_ms"])
+	assert.GreaterOrEqual(t, line["duration_ms"], float64(50))
+	assert.Contains(t, line["caller"], "logger_test.go")
+	assert.NotContains(t, line, "plan")
+
+	var buf bytes.Buffer
+	ctx := logging.WithLogger(context.Background(), logging.New(&buf, "debug"))
+	newQueryLogger(time.Second).Trace(ctx, time.Now(), func() (string, int64) { return "SELECT 1", 1 }, nil)
+	assert.Empty(t, buf.String())
+}
+
+func TestQueryLogger_ExplainsMarkedSlowSelects(t *testing.T) {
+	var explained []string
+	l := newQueryLogger(10 * time.Millisecond)
+	l.explain = func(ctx context.Context, query string) (string, error) {
+		explained = append(explained, query)
+		return "Seq Scan on customers\n  Filter: (email ~~* '%somchai%'::text)", nil
+	}
+
+	line := traceSlowQuery(t, l, context.Background(), "SELECT * FROM customers")
+	assert.NotContains(t, line, "plan")
+
+	line = traceSlowQuery(t, l, ExplainIfSlow(context.Background()), "UPDATE customers SET is_deleted = true")
+	assert.NotContains(t, line, "plan")
+
+	line = traceSlowQuery(t, l, ExplainIfSlow(context.Background()), "SELECT * FROM customers")
+	assert.Equal(t, "Seq Scan on customers\n  Filter: (email ~~* '***'::text)", line["plan"])
+	assert.Equal(t, []string{"SELECT * FROM customers"}, explained)
+}
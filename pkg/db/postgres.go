@@ -1,18 +1,81 @@
 package database
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
-	"os"
+	"log/slog"
+	"time"
+
+	"test-go/pkg/config"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-func ConnectPostgres() (*gorm.DB, error) {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		os.Getenv("DB_HOST"), os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_NAME"), os.Getenv("DB_PORT"),
-	)
+const maxPingBackoff = 10 * time.Second
+
+// ConnectPostgres opens the connection pool and waits until the database
+// answers, so the API survives Postgres starting slower than it does.
+func ConnectPostgres(cfg config.DatabaseConfig) (*gorm.DB, error) {
+	queryLogger := newQueryLogger(cfg.SlowQueryThreshold)
+	// gorm pings when it opens, which would fail before the retries below.
+	db, err := gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{Logger: queryLogger, DisableAutomaticPing: true})
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	configurePool(sqlDB, cfg)
+	if cfg.ExplainSlowQueries {
+		queryLogger.explain = explainAnalyze(sqlDB)
+	}
+
+	if err := ping(sqlDB, cfg); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func configurePool(sqlDB *sql.DB, cfg config.DatabaseConfig) {
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+}
+
+// pinger is the part of the connection pool ping needs.
+type pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+func ping(db pinger, cfg config.DatabaseConfig) error {
+	backoff := cfg.PingBackoff
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), pingTimeout(cfg))
+		err := db.PingContext(ctx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if attempt >= cfg.PingRetries {
+			return fmt.Errorf("failed to ping database after %d attempts: %w", attempt+1, err)
+		}
+
+		slog.Warn("database not ready, retrying",
+			"attempt", attempt+1, "attempts", cfg.PingRetries+1, "error", err, "backoff", backoff.String())
+		time.Sleep(backoff)
+		backoff = min(backoff*2, maxPingBackoff)
+	}
+}
 
-	return gorm.Open(postgres.Open(dsn), &gorm.Config{})
+func pingTimeout(cfg config.DatabaseConfig) time.Duration {
+	if cfg.ConnectTimeout > 0 {
+		return cfg.ConnectTimeout
+	}
+	return 5 * time.Second
 }
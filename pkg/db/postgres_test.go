@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"test-go/pkg/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyDatabase fails the first pings, as Postgres does while it starts.
+type flakyDatabase struct {
+	failures int
+	pings    int
+}
+
+func (d *flakyDatabase) PingContext(ctx context.Context) error {
+	d.pings++
+	if d.pings <= d.failures {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func pingConfig(retries int) config.DatabaseConfig {
+	cfg := config.Default().Database
+	cfg.PingRetries = retries
+	cfg.PingBackoff = time.Millisecond
+	return cfg
+}
+
+func TestPing_RetriesUntilTheDatabaseAnswers(t *testing.T) {
+	db := &flakyDatabase{failures: 2}
+
+	assert.NoError(t, ping(db, pingConfig(3)))
+	assert.Equal(t, 3, db.pings)
+}
+
+func TestPing_GivesUpAfterTheRetries(t *testing.T) {
+	db := &flakyDatabase{failures: 10}
+
+	err := ping(db, pingConfig(2))
+	assert.ErrorContains(t, err, "after 3 attempts")
+	assert.Equal(t, 3, db.pings)
+}
+
+func TestConnectPostgres_RetriesTheFirstPing(t *testing.T) {
+	cfg := pingConfig(1)
+	cfg.Host = "127.0.0.1"
+	cfg.Port = 1 // nothing listens there
+	cfg.User, cfg.Password, cfg.Name = "api", "secret", "api"
+	cfg.ConnectTimeout = time.Second
+
+	_, err := ConnectPostgres(cfg)
+	assert.ErrorContains(t, err, "failed to ping database after 2 attempts")
+}
@@ -0,0 +1,339 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"test-go/pkg/config"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// replicaLagQuery returns how far, in seconds, a replica is behind its
+// primary. A replica that replayed everything it received is not behind, even
+// when the primary has been idle since the last replayed transaction. A server
+// that is not a replica reports no lag.
+const replicaLagQuery = `SELECT CASE
+	WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+END`
+
+// Replicas sends the reads made outside transactions to read replicas and
+// everything else to the primary. Reads go to the primary instead while no
+// replica is healthy, and during the read-your-writes window following a write
+// of the same session, so that a client reads back its own changes. Writes are
+// only known to the process making them, so clients must be routed to the same
+// replica of the API for the window to hold.
+type Replicas struct {
+	primary  gorm.ConnPool
+	replicas []*replica
+	maxLag   time.Duration
+	interval time.Duration
+	window   time.Duration
+	session  func(ctx context.Context) string
+	now      func() time.Time
+
+	mu     sync.Mutex
+	writes map[string]time.Time // last write of each session
+}
+
+type replica struct {
+	db      *sql.DB
+	healthy atomic.Bool
+
+	mu     sync.Mutex
+	status ReplicaStatus
+}
+
+// ReplicaStatus is the outcome of the last lag check of a replica.
+type ReplicaStatus struct {
+	// Name is the host and port of the replica.
+	Name      string
+	Healthy   bool
+	Lag       time.Duration
+	Err       error
+	CheckedAt time.Time
+}
+
+// UseReplicas makes db read from the replicas of cfg, which must not be empty,
+// and checks their lag once. session returns the session of a query context,
+// typically the request principal; queries without one are never sent to the
+// primary for having written. Run keeps checking the lag.
+func UseReplicas(db *gorm.DB, cfg config.DatabaseConfig, session func(ctx context.Context) string) (*Replicas, error) {
+	primary, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Replicas{
+		primary:  primary,
+		maxLag:   cfg.ReplicaMaxLag,
+		interval: cfg.ReplicaCheckInterval,
+		window:   cfg.ReadYourWritesWindow,
+		session:  session,
+		now:      time.Now,
+		writes:   map[string]time.Time{},
+	}
+	dialectors := make([]gorm.Dialector, 0, len(cfg.Replicas))
+	for _, dsn := range cfg.Replicas {
+		connConfig, err := pgx.ParseConfig(dsn)
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("invalid replica DSN: %w", err)
+		}
+		applyTimeouts(connConfig, cfg)
+		sqlDB := stdlib.OpenDB(*connConfig)
+		configurePool(sqlDB, cfg)
+
+		replica := &replica{db: sqlDB}
+		replica.status.Name = fmt.Sprintf("%s:%d", connConfig.Host, connConfig.Port)
+		r.replicas = append(r.replicas, replica)
+		dialectors = append(dialectors, postgres.New(postgres.Config{Conn: sqlDB}))
+	}
+
+	err = db.Use(dbresolver.Register(dbresolver.Config{
+		Replicas: dialectors,
+		Policy:   dbresolver.PolicyFunc(r.resolve),
+	}))
+	if err == nil {
+		err = r.registerCallbacks(db)
+	}
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	r.check(context.Background())
+	return r, nil
+}
+
+// applyTimeouts gives the connections of a replica the connect and statement
+// timeouts of the primary, unless its DSN sets its own.
+func applyTimeouts(connConfig *pgx.ConnConfig, cfg config.DatabaseConfig) {
+	if connConfig.ConnectTimeout == 0 && cfg.ConnectTimeout > 0 {
+		connConfig.ConnectTimeout = cfg.ConnectTimeout
+	}
+	if _, ok := connConfig.RuntimeParams["statement_timeout"]; !ok && cfg.StatementTimeout > 0 {
+		connConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10)
+	}
+}
+
+// registerCallbacks wraps the callbacks of the resolver choosing the database
+// of reads, and records the writes of every session, which include the reads
+// locking rows.
+func (r *Replicas) registerCallbacks(db *gorm.DB) error {
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Query().Before("*").Replace("gorm:db_resolver", r.route(callbacks.Query().Get("gorm:db_resolver"))),
+		callbacks.Row().Before("*").Replace("gorm:db_resolver", r.route(callbacks.Row().Get("gorm:db_resolver"))),
+		callbacks.Raw().Before("*").Replace("gorm:db_resolver", r.route(callbacks.Raw().Get("gorm:db_resolver"))),
+		callbacks.Create().After("*").Register("app:record_write", r.recordWrite),
+		callbacks.Update().After("*").Register("app:record_write", r.recordWrite),
+		callbacks.Delete().After("*").Register("app:record_write", r.recordWrite),
+		callbacks.Raw().After("*").Register("app:record_write", r.recordWrite),
+		callbacks.Query().After("*").Register("app:record_write", r.recordWrite),
+		callbacks.Row().After("*").Register("app:record_write", r.recordWrite),
+	)
+}
+
+// routedSetting marks the statements already routed, since marking a statement
+// as a write runs the resolver of queries again.
+const routedSetting = "app:read_routed"
+
+// route returns resolve sending the statement to the primary first when it
+// must not read from a replica.
+func (r *Replicas) route(resolve func(*gorm.DB)) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		if _, routed := db.Statement.Settings.LoadOrStore(routedSetting, true); !routed && r.readsPrimary(db.Statement.Context) {
+			dbresolver.Write.ModifyStatement(db.Statement)
+		}
+		resolve(db)
+	}
+}
+
+type readPrimaryKey struct{}
+
+// ReadPrimary returns ctx making the queries using it read from the primary,
+// for reads that must not be stale, such as those filling a cache that is
+// invalidated when the primary commits.
+func ReadPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readPrimaryKey{}, true)
+}
+
+func (r *Replicas) readsPrimary(ctx context.Context) bool {
+	if primary, _ := ctx.Value(readPrimaryKey{}).(bool); primary || !r.anyHealthy() {
+		return true
+	}
+	session := r.session(ctx)
+	if session == "" || r.window <= 0 {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	wrote, ok := r.writes[session]
+	return ok && r.now().Sub(wrote) < r.window
+}
+
+// lockingClause matches the row locking clauses of a select, with or without
+// OF, NOWAIT or SKIP LOCKED.
+var lockingClause = regexp.MustCompile(`(?i)\bFOR\s+(UPDATE|NO\s+KEY\s+UPDATE|SHARE|KEY\s+SHARE)\b`)
+
+// isWrite reports whether sql may write: every statement but the selects not
+// locking rows.
+func isWrite(sql string) bool {
+	sql = strings.TrimSpace(sql)
+	if len(sql) < 6 || !strings.EqualFold(sql[:6], "select") {
+		return true
+	}
+	return lockingClause.MatchString(sql)
+}
+
+// recordWrite starts the read-your-writes window of the session of db when
+// its statement writes.
+func (r *Replicas) recordWrite(db *gorm.DB) {
+	if db.Error != nil || !isWrite(db.Statement.SQL.String()) {
+		return
+	}
+	r.wrote(db.Statement.Context)
+}
+
+// wrote starts the read-your-writes window of the session of ctx.
+func (r *Replicas) wrote(ctx context.Context) {
+	if r.window <= 0 {
+		return
+	}
+	session := r.session(ctx)
+	if session == "" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writes[session] = r.now()
+}
+
+// resolve picks a healthy replica among pools, falling back to the primary.
+// It is only consulted when there are several replicas.
+func (r *Replicas) resolve(pools []gorm.ConnPool) gorm.ConnPool {
+	var healthy []gorm.ConnPool
+	for _, replica := range r.replicas {
+		if replica.healthy.Load() {
+			healthy = append(healthy, replica.db)
+		}
+	}
+	if len(healthy) == 0 {
+		return r.primary
+	}
+	return healthy[rand.Intn(len(healthy))]
+}
+
+func (r *Replicas) anyHealthy() bool {
+	for _, replica := range r.replicas {
+		if replica.healthy.Load() {
+			return true
+		}
+	}
+	return false
+}
+
+// Run checks the lag of every replica each check interval until ctx is done.
+func (r *Replicas) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.check(ctx)
+			r.forgetWrites()
+		}
+	}
+}
+
+func (r *Replicas) check(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, replica := range r.replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.checkReplica(ctx, replica)
+		}()
+	}
+	wg.Wait()
+}
+
+func (r *Replicas) checkReplica(ctx context.Context, replica *replica) {
+	ctx, cancel := context.WithTimeout(ctx, r.interval)
+	defer cancel()
+
+	var lag float64
+	err := replica.db.QueryRowContext(ctx, replicaLagQuery).Scan(&lag)
+
+	replica.mu.Lock()
+	status := ReplicaStatus{
+		Name:      replica.status.Name,
+		Lag:       time.Duration(lag * float64(time.Second)),
+		Err:       err,
+		CheckedAt: r.now(),
+	}
+	status.Healthy = err == nil && status.Lag <= r.maxLag
+	replica.status = status
+	replica.mu.Unlock()
+
+	if replica.healthy.Swap(status.Healthy) == status.Healthy {
+		return
+	}
+	if status.Healthy {
+		slog.Info("reading from replica", "replica", status.Name, "lag", status.Lag.String())
+	} else {
+		slog.Warn("replica unavailable or lagging, reading from the primary instead",
+			"replica", status.Name, "lag", status.Lag.String(), "maxLag", r.maxLag.String(), "error", err)
+	}
+}
+
+// forgetWrites drops the writes whose window is over.
+func (r *Replicas) forgetWrites() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for session, wrote := range r.writes {
+		if r.now().Sub(wrote) >= r.window {
+			delete(r.writes, session)
+		}
+	}
+}
+
+// Status returns the outcome of the last lag check of every replica.
+func (r *Replicas) Status() []ReplicaStatus {
+	statuses := make([]ReplicaStatus, len(r.replicas))
+	for i, replica := range r.replicas {
+		replica.mu.Lock()
+		statuses[i] = replica.status
+		replica.mu.Unlock()
+	}
+	return statuses
+}
+
+// Close closes the connection pools of the replicas.
+func (r *Replicas) Close() error {
+	var errs []error
+	for _, replica := range r.replicas {
+		errs = append(errs, replica.db.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,203 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"test-go/internal/testdb"
+	"test-go/pkg/config"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type sessionKey struct{}
+
+// withApplicationName returns dsn connecting as the application name.
+func withApplicationName(dsn, name string) string {
+	if !strings.Contains(dsn, "://") {
+		return dsn + " application_name=" + name
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&application_name=" + name
+	}
+	return dsn + "?application_name=" + name
+}
+
+// openReplicatedDatabase connects to the Postgres database at
+// TEST_DATABASE_DSN as both the primary and its replica, which tell themselves
+// apart by their application names. Tests using it are skipped when the
+// variable is not set.
+func openReplicatedDatabase(t *testing.T) (*gorm.DB, *Replicas) {
+	dsn := testdb.DSN(t)
+	db := testdb.Connect(t, withApplicationName(dsn, "primary"))
+
+	cfg := config.Default().Database
+	cfg.Replicas = []string{withApplicationName(dsn, "replica")}
+	replicas, err := UseReplicas(db, cfg, func(ctx context.Context) string {
+		session, _ := ctx.Value(sessionKey{}).(string)
+		return session
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { replicas.Close() })
+	return db, replicas
+}
+
+// readFrom returns the application name of the server reading with ctx.
+func readFrom(t *testing.T, db *gorm.DB, ctx context.Context) string {
+	var name string
+	require.NoError(t, db.WithContext(ctx).Raw(`SELECT current_setting('application_name')`).Scan(&name).Error)
+	return name
+}
+
+func TestIntegration_ReplicasServeReadsExceptAfterWritesAndWhenLagging(t *testing.T) {
+	db, replicas := openReplicatedDatabase(t)
+	ann := context.WithValue(context.Background(), sessionKey{}, "ann")
+	bob := context.WithValue(context.Background(), sessionKey{}, "bob")
+
+	assert.Equal(t, "replica", readFrom(t, db, ann))
+	assert.Equal(t, "primary", readFrom(t, db, ReadPrimary(ann)))
+
+	var inTx string
+	err := db.WithContext(ann).Transaction(func(tx *gorm.DB) error {
+		return tx.Raw(`SELECT current_setting('application_name')`).Scan(&inTx).Error
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "primary", inTx, "transactions use the primary")
+
+	require.NoError(t, db.WithContext(ann).Exec(`DO $$ BEGIN END $$`).Error)
+	assert.Equal(t, "primary", readFrom(t, db, ann), "ann reads back what ann wrote")
+	assert.Equal(t, "replica", readFrom(t, db, bob))
+
+	now := time.Now()
+	replicas.now = func() time.Time { return now.Add(replicas.window) }
+	assert.Equal(t, "replica", readFrom(t, db, ann), "the window is over")
+
+	status := replicas.Status()
+	require.Len(t, status, 1)
+	assert.True(t, status[0].Healthy)
+
+	replicas.maxLag = -time.Second
+	replicas.check(context.Background())
+	assert.False(t, replicas.Status()[0].Healthy)
+	assert.Equal(t, "primary", readFrom(t, db, bob), "lagging replicas are not read from")
+}
+
+// testReplicas returns replicas of primary whose window starts at now, with
+// sessions taken from sessionKey.
+func testReplicas(primary *sql.DB, now *time.Time, replicas ...*sql.DB) *Replicas {
+	r := &Replicas{
+		primary: primary,
+		window:  time.Second,
+		session: func(ctx context.Context) string {
+			session, _ := ctx.Value(sessionKey{}).(string)
+			return session
+		},
+		now:    func() time.Time { return *now },
+		writes: map[string]time.Time{},
+	}
+	for _, db := range replicas {
+		replica := &replica{db: db}
+		replica.healthy.Store(true)
+		r.replicas = append(r.replicas, replica)
+	}
+	return r
+}
+
+func TestIsWrite(t *testing.T) {
+	for sql, write := range map[string]bool{
+		`SELECT * FROM customers WHERE id = 1`:                                     false,
+		`  select count(*) from customers`:                                         false,
+		`SELECT * FROM customers WHERE id = 1 FOR UPDATE`:                          true,
+		`SELECT * FROM customers WHERE id = 1 FOR UPDATE OF customers`:             true,
+		`SELECT * FROM customers FOR NO KEY UPDATE NOWAIT`:                         true,
+		`SELECT * FROM customers FOR SHARE`:                                        true,
+		`select * from customers for key share skip locked`:                        true,
+		`SELECT * FROM outbox ORDER BY id LIMIT 10 FOR UPDATE SKIP LOCKED`:         true,
+		`SELECT pg_advisory_xact_lock(1)`:                                          false,
+		`UPDATE customers SET name_en = 'Ann' WHERE id = 1`:                        true,
+		`INSERT INTO customers (email) VALUES ('ann@example.com')`:                 true,
+		`DO $$ BEGIN END $$`:                                                       true,
+		`WITH gone AS (DELETE FROM outbox RETURNING id) SELECT count(*) FROM gone`: true,
+	} {
+		assert.Equal(t, write, isWrite(sql), sql)
+	}
+}
+
+func TestReplicas_RecordWriteStartsTheWindowOfTheSession(t *testing.T) {
+	now := time.Now()
+	r := testReplicas(&sql.DB{}, &now, &sql.DB{})
+	ann := context.WithValue(context.Background(), sessionKey{}, "ann")
+	bob := context.WithValue(context.Background(), sessionKey{}, "bob")
+	statement := func(ctx context.Context, sql string, err error) *gorm.DB {
+		db := &gorm.DB{Statement: &gorm.Statement{Context: ctx}, Error: err}
+		db.Statement.SQL.WriteString(sql)
+		return db
+	}
+
+	r.recordWrite(statement(ann, `SELECT * FROM customers`, nil))
+	r.recordWrite(statement(ann, `UPDATE customers SET email = 'x'`, errors.New("duplicate email")))
+	r.recordWrite(statement(context.Background(), `UPDATE customers SET email = 'x'`, nil))
+	assert.False(t, r.readsPrimary(ann), "reads, failed writes and writes without a session do not count")
+	assert.Empty(t, r.writes)
+
+	r.recordWrite(statement(ann, `SELECT * FROM customers WHERE id = 1 FOR UPDATE`, nil))
+	assert.True(t, r.readsPrimary(ann))
+	assert.False(t, r.readsPrimary(bob))
+	assert.True(t, r.readsPrimary(ReadPrimary(bob)))
+
+	now = now.Add(r.window - time.Millisecond)
+	r.forgetWrites()
+	assert.True(t, r.readsPrimary(ann), "the window is not over")
+	assert.Contains(t, r.writes, "ann")
+
+	now = now.Add(time.Millisecond)
+	assert.False(t, r.readsPrimary(ann), "the window is over")
+	r.forgetWrites()
+	assert.Empty(t, r.writes)
+
+	r.window = 0
+	r.wrote(bob)
+	assert.Empty(t, r.writes, "no window is kept when it is disabled")
+}
+
+func TestReplicas_ReadsPrimaryWhileNoReplicaIsHealthy(t *testing.T) {
+	now := time.Now()
+	primary, first, second := &sql.DB{}, &sql.DB{}, &sql.DB{}
+	r := testReplicas(primary, &now, first, second)
+	ctx := context.Background()
+
+	assert.False(t, r.readsPrimary(ctx))
+	r.replicas[0].healthy.Store(false)
+	for range 10 {
+		assert.Same(t, second, r.resolve(nil), "only the healthy replica is read from")
+	}
+
+	r.replicas[1].healthy.Store(false)
+	assert.Same(t, primary, r.resolve(nil))
+	assert.True(t, r.readsPrimary(ctx))
+}
+
+func TestApplyTimeouts_DefaultsToThoseOfThePrimary(t *testing.T) {
+	cfg := config.Default().Database
+	cfg.ConnectTimeout = 3 * time.Second
+	cfg.StatementTimeout = 15 * time.Second
+
+	connConfig, err := pgx.ParseConfig("host=replica-1 user=app dbname=app")
+	require.NoError(t, err)
+	applyTimeouts(connConfig, cfg)
+	assert.Equal(t, 3*time.Second, connConfig.ConnectTimeout)
+	assert.Equal(t, "15000", connConfig.RuntimeParams["statement_timeout"])
+
+	connConfig, err = pgx.ParseConfig("host=replica-1 user=app dbname=app connect_timeout=1 statement_timeout=500")
+	require.NoError(t, err)
+	applyTimeouts(connConfig, cfg)
+	assert.Equal(t, time.Second, connConfig.ConnectTimeout, "the DSN wins")
+	assert.Equal(t, "500", connConfig.RuntimeParams["statement_timeout"])
+}
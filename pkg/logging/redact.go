@@ -0,0 +1,79 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+var sqlStringPattern = regexp.MustCompile(`'(?:[^']|'')*'`)
+
+// attributes whose whole value is personal data
+var nameKeys = map[string]bool{
+	"name": true, "name_th": true, "name_en": true, "nameTh": true, "nameEn": true,
+}
+
+// attributes that identify the staff member acting, kept so access logs can
+// still answer who did what
+var keptKeys = map[string]bool{
+	"principal": true,
+}
+
+// MaskEmail keeps the first character of the local part and the domain, so
+// logs stay useful for support without exposing the address.
+func MaskEmail(email string) string {
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok {
+		return MaskName(email)
+	}
+	return MaskName(local) + "@" + domain
+}
+
+// MaskName keeps the first character only.
+func MaskName(name string) string {
+	if name == "" {
+		return ""
+	}
+	r, _ := utf8.DecodeRuneInString(name)
+	return string(r) + "****"
+}
+
+// Redact masks every email address in free text such as error and panic
+// messages. Names can not be recognised in free text, so values holding them
+// must mask themselves when formatted, like customer.Customer does.
+func Redact(s string) string {
+	return emailPattern.ReplaceAllStringFunc(s, MaskEmail)
+}
+
+// RedactSQL replaces the string literals of an interpolated query, which hold
+// names and emails, and masks any remaining email.
+func RedactSQL(sql string) string {
+	return Redact(sqlStringPattern.ReplaceAllString(sql, "'***'"))
+}
+
+// redactAttr is the slog ReplaceAttr hook applied to every log line.
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() == slog.KindAny {
+		if err, ok := a.Value.Any().(error); ok {
+			a.Value = slog.StringValue(err.Error())
+		}
+	}
+	if a.Value.Kind() != slog.KindString {
+		return a
+	}
+
+	value := a.Value.String()
+	switch {
+	case keptKeys[a.Key]:
+		return a
+	case nameKeys[a.Key]:
+		return slog.String(a.Key, MaskName(value))
+	case a.Key == "sql":
+		return slog.String(a.Key, RedactSQL(value))
+	default:
+		return slog.String(a.Key, Redact(value))
+	}
+}
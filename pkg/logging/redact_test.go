@@ -0,0 +1,41 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMasking(t *testing.T) {
+	assert.Equal(t, "s****@example.com", MaskEmail("somchai@example.com"))
+	assert.Equal(t, "ส****", MaskName("สมชาย ใจดี"))
+	assert.Equal(t, "", MaskName(""))
+	assert.Equal(t, `duplicate key "s****@example.com"`, Redact(`duplicate key "somchai@example.com"`))
+	assert.Equal(t,
+		`SELECT * FROM "customers" WHERE email = '***' AND name_th ILIKE '***' LIMIT 10`,
+		RedactSQL(`SELECT * FROM "customers" WHERE email = 'somchai@example.com' AND name_th ILIKE '%สม''ชาย%' LIMIT 10`))
+}
+
+func TestNew_RedactsAttributesAndMessages(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "info")
+
+	logger.Error("panic: customer somchai@example.com not found",
+		"name_th", "สมชาย ใจดี",
+		"error", errors.New("insert somchai@example.com failed"),
+		"sql", `INSERT INTO customers (name_en) VALUES ('Somchai')`,
+		"id", 7,
+	)
+
+	var line map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, "panic: customer s****@example.com not found", line["msg"])
+	assert.Equal(t, "ส****", line["name_th"])
+	assert.Equal(t, "insert s****@example.com failed", line["error"])
+	assert.Equal(t, `INSERT INTO customers (name_en) VALUES ('***')`, line["sql"])
+	assert.Equal(t, float64(7), line["id"])
+	assert.NotContains(t, buf.String(), "somchai")
+}
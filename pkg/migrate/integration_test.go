@@ -0,0 +1,60 @@
+package migrate_test
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+
+	"test-go/internal/testdb"
+	"test-go/pkg/migrate"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openTestDatabase connects to the test database in a schema of its own,
+// dropped after the test. The test lives outside package migrate since the
+// test database helper migrates with it.
+func openTestDatabase(t *testing.T) *sql.DB {
+	db, err := sql.Open("pgx", testdb.DSN(t))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	// The schema is set on the only connection.
+	db.SetMaxOpenConns(1)
+
+	schema := fmt.Sprintf("migrate_test_%d", os.Getpid())
+	_, err = db.Exec(`CREATE SCHEMA ` + schema)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
+	_, err = db.Exec(`SET search_path TO ` + schema)
+	require.NoError(t, err)
+	return db
+}
+
+func TestIntegration_RunnerAppliesAndRollsBackSQLMigrations(t *testing.T) {
+	db := openTestDatabase(t)
+	runner := migrate.NewRunner(db, []migrate.Migration{
+		{Version: 1, Name: "create_widgets", UpSQL: `CREATE TABLE widgets (id INT PRIMARY KEY)`, DownSQL: `DROP TABLE widgets`},
+		{Version: 2, Name: "add_widget_name", UpSQL: `ALTER TABLE widgets ADD COLUMN name TEXT`, DownSQL: `ALTER TABLE widgets DROP COLUMN name`},
+	})
+
+	require.NoError(t, runner.Up())
+	_, err := db.Exec(`INSERT INTO widgets (id, name) VALUES (1, 'gear')`)
+	assert.NoError(t, err)
+	applied, err := runner.Applied()
+	require.NoError(t, err)
+	assert.Equal(t, map[uint64]bool{1: true, 2: true}, applied)
+
+	require.NoError(t, runner.Down())
+	_, err = db.Exec(`SELECT name FROM widgets`)
+	assert.Error(t, err, "the last migration is rolled back")
+	applied, err = runner.Applied()
+	require.NoError(t, err)
+	assert.Equal(t, map[uint64]bool{1: true}, applied)
+
+	require.NoError(t, runner.Down())
+	_, err = db.Exec(`SELECT 1 FROM widgets`)
+	assert.Error(t, err)
+}
@@ -0,0 +1,148 @@
+package migrate
+
+import (
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// GoMigrationFunc is a migration step written in Go. It runs inside the same
+// transaction that records the migration in the state table.
+type GoMigrationFunc func(tx *sql.Tx) error
+
+type Migration struct {
+	Version uint64
+	Name    string
+	UpSQL   string
+	DownSQL string
+	Up      GoMigrationFunc
+	Down    GoMigrationFunc
+}
+
+func (m Migration) hasUp() bool {
+	return m.Up != nil || m.UpSQL != ""
+}
+
+func (m Migration) hasDown() bool {
+	return m.Down != nil || m.DownSQL != ""
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%06d_%s", m.Version, m.Name)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = map[uint64]Migration{}
+)
+
+// Register adds a Go migration. It is meant to be called from init functions
+// in the migrations package and panics on a duplicate version.
+func Register(version uint64, name string, up, down GoMigrationFunc) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[version]; ok {
+		panic(fmt.Sprintf("migrate: duplicate Go migration version %d", version))
+	}
+	registry[version] = Migration{Version: version, Name: name, Up: up, Down: down}
+}
+
+// Registered returns the registered Go migrations ordered by version.
+func Registered() []Migration {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	migrations := make([]Migration, 0, len(registry))
+	for _, m := range registry {
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations
+}
+
+// Load reads the SQL migrations in fsys and merges them with the registered
+// Go migrations. A version may be defined either in SQL or in Go, not both.
+func Load(fsys fs.FS) ([]Migration, error) {
+	return merge(fsys, Registered())
+}
+
+func merge(fsys fs.FS, goMigrations []Migration) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations directory: %w", err)
+	}
+
+	byVersion := map[uint64]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		var direction string
+		switch {
+		case strings.HasSuffix(entry.Name(), ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(entry.Name(), ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		version, name, err := parseFileName(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		sqlBytes, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.UpSQL = string(sqlBytes)
+		} else {
+			m.DownSQL = string(sqlBytes)
+		}
+	}
+
+	for _, gm := range goMigrations {
+		if existing, ok := byVersion[gm.Version]; ok {
+			return nil, fmt.Errorf("migration version %d is defined by both %s and Go migration %s", gm.Version, existing, gm)
+		}
+		gm := gm
+		byVersion[gm.Version] = &gm
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if !m.hasUp() {
+			return nil, fmt.Errorf("migration %s has no up step", m)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// parseFileName splits "000001_create_customers.up.sql" into 1 and "create_customers".
+func parseFileName(fileName string) (uint64, string, error) {
+	base := strings.TrimSuffix(strings.TrimSuffix(fileName, ".up.sql"), ".down.sql")
+	versionPart, name, _ := strings.Cut(base, "_")
+
+	version, err := strconv.ParseUint(versionPart, 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid migration file name %s: %w", fileName, err)
+	}
+	return version, name, nil
+}
@@ -0,0 +1,64 @@
+package migrate
+
+import (
+	"database/sql"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func noop(tx *sql.Tx) error { return nil }
+
+func TestMerge_InterleavesGoAndSQLByVersion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000001_create_customers.up.sql":   {Data: []byte("CREATE TABLE customers ();")},
+		"000001_create_customers.down.sql": {Data: []byte("DROP TABLE customers;")},
+		"000003_add_index.up.sql":          {Data: []byte("CREATE INDEX ...;")},
+		"README.md":                        {Data: []byte("ignored")},
+	}
+	goMigrations := []Migration{{Version: 2, Name: "backfill_emails", Up: noop}}
+
+	migrations, err := merge(fsys, goMigrations)
+	assert.NoError(t, err)
+	assert.Len(t, migrations, 3)
+
+	assert.Equal(t, uint64(1), migrations[0].Version)
+	assert.Equal(t, "create_customers", migrations[0].Name)
+	assert.Equal(t, "DROP TABLE customers;", migrations[0].DownSQL)
+
+	assert.Equal(t, uint64(2), migrations[1].Version)
+	assert.NotNil(t, migrations[1].Up)
+
+	assert.Equal(t, uint64(3), migrations[2].Version)
+	assert.False(t, migrations[2].hasDown())
+}
+
+func TestMerge_RejectsDuplicateVersion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000002_backfill.up.sql": {Data: []byte("UPDATE customers SET email = email;")},
+	}
+	goMigrations := []Migration{{Version: 2, Name: "backfill_emails", Up: noop}}
+
+	_, err := merge(fsys, goMigrations)
+	assert.Error(t, err)
+}
+
+func TestMerge_RejectsMissingUp(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000004_orphan.down.sql": {Data: []byte("DROP TABLE orphan;")},
+	}
+
+	_, err := merge(fsys, nil)
+	assert.Error(t, err)
+}
+
+func TestParseFileName(t *testing.T) {
+	version, name, err := parseFileName("000012_add_audit_table.up.sql")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(12), version)
+	assert.Equal(t, "add_audit_table", name)
+
+	_, _, err = parseFileName("create_customers.up.sql")
+	assert.Error(t, err)
+}
@@ -0,0 +1,138 @@
+package migrate
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+const createStateTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT PRIMARY KEY,
+    name TEXT NOT NULL,
+    applied_at TIMESTAMP NOT NULL DEFAULT NOW()
+)`
+
+type Runner struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func NewRunner(db *sql.DB, migrations []Migration) *Runner {
+	return &Runner{db: db, migrations: migrations}
+}
+
+// Applied returns the versions recorded in the state table.
+func (r *Runner) Applied() (map[uint64]bool, error) {
+	if _, err := r.db.Exec(createStateTable); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	rows, err := r.db.Query(`SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[uint64]bool{}
+	for rows.Next() {
+		var version uint64
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// Up applies every pending migration in version order, each in its own transaction.
+func (r *Runner) Up() error {
+	applied, err := r.Applied()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range r.migrations {
+		if applied[m.Version] {
+			continue
+		}
+
+		fmt.Println("Running migration:", m)
+		err := r.inTx(func(tx *sql.Tx) error {
+			if err := run(tx, m.UpSQL, m.Up); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to execute migration %s: %w", m, err)
+		}
+	}
+	return nil
+}
+
+// Down rolls back the most recently applied migration.
+func (r *Runner) Down() error {
+	return r.down(1)
+}
+
+// DownAll rolls back every applied migration, newest first.
+func (r *Runner) DownAll() error {
+	return r.down(len(r.migrations))
+}
+
+// down rolls back the steps most recently applied migrations.
+func (r *Runner) down(steps int) error {
+	applied, err := r.Applied()
+	if err != nil {
+		return err
+	}
+
+	rolledBack := 0
+	for i := len(r.migrations) - 1; i >= 0 && rolledBack < steps; i-- {
+		m := r.migrations[i]
+		if !applied[m.Version] {
+			continue
+		}
+		if !m.hasDown() {
+			return fmt.Errorf("migration %s has no down step", m)
+		}
+
+		fmt.Println("Rolling back:", m)
+		err := r.inTx(func(tx *sql.Tx) error {
+			if err := run(tx, m.DownSQL, m.Down); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to execute rollback %s: %w", m, err)
+		}
+		rolledBack++
+	}
+
+	if rolledBack == 0 {
+		fmt.Println("No migration to roll back.")
+	}
+	return nil
+}
+
+func (r *Runner) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func run(tx *sql.Tx, sqlText string, fn GoMigrationFunc) error {
+	if fn != nil {
+		return fn(tx)
+	}
+	_, err := tx.Exec(sqlText)
+	return err
+}
@@ -0,0 +1,191 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDatabase is a database/sql connector keeping the state table in memory,
+// so the runner can be tested without Postgres. The other statements are
+// logged when their transaction commits.
+type fakeDatabase struct {
+	mu       sync.Mutex
+	versions map[uint64]string
+	log      []string
+}
+
+func newFakeDatabase() *fakeDatabase {
+	return &fakeDatabase{versions: map[uint64]string{}}
+}
+
+func (d *fakeDatabase) Connect(ctx context.Context) (driver.Conn, error) {
+	return &fakeConn{db: d}, nil
+}
+
+func (d *fakeDatabase) Driver() driver.Driver { return nil }
+
+type fakeConn struct {
+	db      *fakeDatabase
+	pending []func()
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.pending = []func(){}
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	for _, apply := range c.pending {
+		apply()
+	}
+	c.pending = nil
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	c.pending = nil
+	return nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	var apply func()
+	switch {
+	case strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS schema_migrations"):
+		return driver.RowsAffected(0), nil
+	case strings.HasPrefix(query, "INSERT INTO schema_migrations"):
+		version, name := uint64(args[0].Value.(int64)), args[1].Value.(string)
+		apply = func() { c.db.versions[version] = name }
+	case strings.HasPrefix(query, "DELETE FROM schema_migrations"):
+		version := uint64(args[0].Value.(int64))
+		apply = func() { delete(c.db.versions, version) }
+	default:
+		apply = func() { c.db.log = append(c.db.log, query) }
+	}
+	if c.pending == nil {
+		return nil, fmt.Errorf("%q ran outside a transaction", query)
+	}
+	c.pending = append(c.pending, apply)
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if query != `SELECT version FROM schema_migrations` {
+		return nil, fmt.Errorf("unexpected query %q", query)
+	}
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	rows := &fakeRows{}
+	for version := range c.db.versions {
+		rows.versions = append(rows.versions, int64(version))
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	versions []int64
+}
+
+func (r *fakeRows) Columns() []string { return []string{"version"} }
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.versions) == 0 {
+		return io.EOF
+	}
+	dest[0], r.versions = r.versions[0], r.versions[1:]
+	return nil
+}
+
+func TestRunner_AppliesRecordsAndRollsBackRegisteredGoMigrations(t *testing.T) {
+	Register(2, "lowercase_emails",
+		func(tx *sql.Tx) error {
+			_, err := tx.Exec(`UPDATE customers SET email = lower(email)`)
+			return err
+		},
+		func(tx *sql.Tx) error {
+			_, err := tx.Exec(`UPDATE customers SET email = email`)
+			return err
+		})
+	migrations, err := Load(fstest.MapFS{
+		"000001_create_customers.up.sql":   {Data: []byte("CREATE TABLE customers ();")},
+		"000001_create_customers.down.sql": {Data: []byte("DROP TABLE customers;")},
+	})
+	require.NoError(t, err)
+
+	fake := newFakeDatabase()
+	runner := NewRunner(sql.OpenDB(fake), migrations)
+
+	require.NoError(t, runner.Up())
+	assert.Equal(t, map[uint64]string{1: "create_customers", 2: "lowercase_emails"}, fake.versions)
+	assert.Equal(t, []string{"CREATE TABLE customers ();", "UPDATE customers SET email = lower(email)"}, fake.log)
+
+	require.NoError(t, runner.Up())
+	assert.Len(t, fake.log, 2, "applied migrations do not run again")
+
+	require.NoError(t, runner.Down())
+	assert.Equal(t, map[uint64]string{1: "create_customers"}, fake.versions)
+	assert.Equal(t, "UPDATE customers SET email = email", fake.log[2])
+
+	applied, err := runner.Applied()
+	require.NoError(t, err)
+	assert.Equal(t, map[uint64]bool{1: true}, applied)
+}
+
+func TestRunner_FailedMigrationIsNotRecorded(t *testing.T) {
+	fake := newFakeDatabase()
+	runner := NewRunner(sql.OpenDB(fake), []Migration{
+		{Version: 1, Name: "create_customers", UpSQL: "CREATE TABLE customers ();"},
+		{Version: 2, Name: "backfill", Up: func(tx *sql.Tx) error {
+			if _, err := tx.Exec(`UPDATE customers SET email = lower(email)`); err != nil {
+				return err
+			}
+			return errors.New("duplicate email")
+		}},
+	})
+
+	err := runner.Up()
+	assert.ErrorContains(t, err, "000002_backfill")
+	assert.Equal(t, map[uint64]string{1: "create_customers"}, fake.versions)
+	assert.Equal(t, []string{"CREATE TABLE customers ();"}, fake.log, "the failed migration is rolled back")
+
+	assert.ErrorContains(t, runner.Down(), "has no down step")
+}
+
+func TestRunner_DownAllRollsBackEveryMigrationNewestFirst(t *testing.T) {
+	fake := newFakeDatabase()
+	runner := NewRunner(sql.OpenDB(fake), []Migration{
+		{Version: 1, Name: "create_customers", UpSQL: "CREATE TABLE customers ();", DownSQL: "DROP TABLE customers;"},
+		{Version: 2, Name: "create_orders", UpSQL: "CREATE TABLE orders ();", DownSQL: "DROP TABLE orders;"},
+		{Version: 3, Name: "create_invoices", UpSQL: "CREATE TABLE invoices ();", DownSQL: "DROP TABLE invoices;"},
+	})
+	require.NoError(t, runner.Up())
+
+	require.NoError(t, runner.Down())
+	assert.Equal(t, map[uint64]string{1: "create_customers", 2: "create_orders"}, fake.versions, "down rolls back one migration")
+
+	require.NoError(t, runner.DownAll())
+	assert.Empty(t, fake.versions)
+	assert.Equal(t, []string{"DROP TABLE invoices;", "DROP TABLE orders;", "DROP TABLE customers;"}, fake.log[3:])
+
+	require.NoError(t, runner.DownAll(), "nothing left to roll back")
+}
@@ -0,0 +1,253 @@
+package migrate
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm/schema"
+)
+
+type Column struct {
+	Name     string
+	Type     string
+	Nullable bool
+}
+
+type Index struct {
+	Columns []string
+	Unique  bool
+}
+
+func (i Index) String() string {
+	kind := "index"
+	if i.Unique {
+		kind = "unique index"
+	}
+	return fmt.Sprintf("%s (%s)", kind, strings.Join(i.Columns, ", "))
+}
+
+type TableSchema struct {
+	Name    string
+	Columns map[string]Column
+	Indexes []Index
+}
+
+// ExpectedSchema describes the table a gorm model maps to. Non-pointer Go
+// fields cannot hold NULL, so their columns are expected to be NOT NULL.
+func ExpectedSchema(model interface{}) (TableSchema, error) {
+	s, err := schema.Parse(model, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		return TableSchema{}, fmt.Errorf("failed to parse model %T: %w", model, err)
+	}
+
+	table := TableSchema{Name: s.Table, Columns: map[string]Column{}}
+	dialector := postgres.Dialector{}
+
+	var primaryKeys []string
+	for _, field := range s.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		table.Columns[field.DBName] = Column{
+			Name:     field.DBName,
+			Type:     normalizeType(dialector.DataTypeOf(field)),
+			Nullable: !field.PrimaryKey && !field.NotNull && isNullableGoType(field.FieldType),
+		}
+		if field.PrimaryKey {
+			primaryKeys = append(primaryKeys, field.DBName)
+		}
+		if field.Unique {
+			table.Indexes = append(table.Indexes, Index{Columns: []string{field.DBName}, Unique: true})
+		}
+	}
+	if len(primaryKeys) > 0 {
+		table.Indexes = append(table.Indexes, Index{Columns: primaryKeys, Unique: true})
+	}
+
+	for _, idx := range s.ParseIndexes() {
+		index := Index{Unique: idx.Class == "UNIQUE"}
+		for _, option := range idx.Fields {
+			index.Columns = append(index.Columns, option.DBName)
+		}
+		table.Indexes = append(table.Indexes, index)
+	}
+
+	return table, nil
+}
+
+// ActualSchema introspects table in the current schema of db.
+func ActualSchema(db *sql.DB, table string) (TableSchema, error) {
+	actual := TableSchema{Name: table, Columns: map[string]Column{}}
+
+	rows, err := db.Query(`
+		SELECT column_name, data_type, is_nullable = 'YES'
+		FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = $1`, table)
+	if err != nil {
+		return actual, fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var column Column
+		if err := rows.Scan(&column.Name, &column.Type, &column.Nullable); err != nil {
+			return actual, err
+		}
+		column.Type = normalizeType(column.Type)
+		actual.Columns[column.Name] = column
+	}
+	if err := rows.Err(); err != nil {
+		return actual, err
+	}
+
+	indexRows, err := db.Query(`
+		SELECT ix.indisunique, string_agg(COALESCE(a.attname, '<expression>'), ',' ORDER BY k.ord)
+		FROM pg_index ix
+		JOIN pg_class t ON t.oid = ix.indrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		CROSS JOIN LATERAL unnest(ix.indkey) WITH ORDINALITY AS k(attnum, ord)
+		LEFT JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+		WHERE n.nspname = current_schema() AND t.relname = $1
+		GROUP BY ix.indexrelid, ix.indisunique`, table)
+	if err != nil {
+		return actual, fmt.Errorf("failed to read indexes of %s: %w", table, err)
+	}
+	defer indexRows.Close()
+
+	for indexRows.Next() {
+		var index Index
+		var columns string
+		if err := indexRows.Scan(&index.Unique, &columns); err != nil {
+			return actual, err
+		}
+		index.Columns = strings.Split(columns, ",")
+		actual.Indexes = append(actual.Indexes, index)
+	}
+
+	return actual, indexRows.Err()
+}
+
+// Diff lists the differences between the expected and the actual table,
+// or nothing when they match.
+func Diff(expected, actual TableSchema) []string {
+	var diffs []string
+
+	if len(actual.Columns) == 0 {
+		return []string{fmt.Sprintf("table %s: missing in database", expected.Name)}
+	}
+
+	for _, name := range sortedKeys(expected.Columns) {
+		want := expected.Columns[name]
+		got, ok := actual.Columns[name]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("table %s: column %s missing in database", expected.Name, name))
+			continue
+		}
+		if want.Type != got.Type {
+			diffs = append(diffs, fmt.Sprintf("table %s: column %s type: model %s, database %s", expected.Name, name, want.Type, got.Type))
+		}
+		if want.Nullable != got.Nullable {
+			diffs = append(diffs, fmt.Sprintf("table %s: column %s nullable: model %t, database %t", expected.Name, name, want.Nullable, got.Nullable))
+		}
+	}
+	for _, name := range sortedKeys(actual.Columns) {
+		if _, ok := expected.Columns[name]; !ok {
+			diffs = append(diffs, fmt.Sprintf("table %s: column %s missing in model", expected.Name, name))
+		}
+	}
+
+	expectedIndexes := indexSet(expected.Indexes)
+	actualIndexes := indexSet(actual.Indexes)
+	for _, key := range sortedKeys(expectedIndexes) {
+		if _, ok := actualIndexes[key]; !ok {
+			diffs = append(diffs, fmt.Sprintf("table %s: %s missing in database", expected.Name, key))
+		}
+	}
+	for _, key := range sortedKeys(actualIndexes) {
+		if _, ok := expectedIndexes[key]; !ok {
+			diffs = append(diffs, fmt.Sprintf("table %s: %s missing in model", expected.Name, key))
+		}
+	}
+
+	return diffs
+}
+
+// Verify compares every model against its table and returns the combined diff.
+func Verify(db *sql.DB, models ...interface{}) ([]string, error) {
+	var diffs []string
+	for _, model := range models {
+		expected, err := ExpectedSchema(model)
+		if err != nil {
+			return nil, err
+		}
+		actual, err := ActualSchema(db, expected.Name)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, Diff(expected, actual)...)
+	}
+	return diffs, nil
+}
+
+// normalizeType maps gorm and Postgres spellings of a type to the names used
+// by information_schema.columns.data_type.
+func normalizeType(sqlType string) string {
+	sqlType = strings.ToLower(strings.TrimSpace(sqlType))
+	if i := strings.Index(sqlType, "("); i >= 0 {
+		sqlType = strings.TrimSpace(sqlType[:i])
+	}
+
+	switch sqlType {
+	case "smallserial", "int2":
+		return "smallint"
+	case "serial", "int", "int4":
+		return "integer"
+	case "bigserial", "int8":
+		return "bigint"
+	case "bool":
+		return "boolean"
+	case "varchar":
+		return "character varying"
+	case "decimal":
+		return "numeric"
+	case "timestamp":
+		return "timestamp without time zone"
+	case "timestamptz":
+		return "timestamp with time zone"
+	}
+	return sqlType
+}
+
+func isNullableGoType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		return true
+	case reflect.Struct:
+		// sql.NullString, gorm.DeletedAt and friends
+		_, ok := t.FieldByName("Valid")
+		return ok
+	}
+	return false
+}
+
+func indexSet(indexes []Index) map[string]struct{} {
+	set := map[string]struct{}{}
+	for _, index := range indexes {
+		set[index.String()] = struct{}{}
+	}
+	return set
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
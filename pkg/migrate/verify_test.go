@@ -0,0 +1,71 @@
+package migrate
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type verifyModel struct {
+	Id        uint   `gorm:"primaryKey;type:serial"`
+	Email     string `gorm:"unique"`
+	Nickname  *string
+	Note      sql.NullString
+	IsDeleted bool
+	CreatedAt time.Time `gorm:"type:timestamp"`
+}
+
+func matchingTable() TableSchema {
+	return TableSchema{
+		Name: "verify_models",
+		Columns: map[string]Column{
+			"id":         {Name: "id", Type: "integer"},
+			"email":      {Name: "email", Type: "text"},
+			"nickname":   {Name: "nickname", Type: "text", Nullable: true},
+			"note":       {Name: "note", Type: "text", Nullable: true},
+			"is_deleted": {Name: "is_deleted", Type: "boolean"},
+			"created_at": {Name: "created_at", Type: "timestamp without time zone"},
+		},
+		Indexes: []Index{
+			{Columns: []string{"id"}, Unique: true},
+			{Columns: []string{"email"}, Unique: true},
+		},
+	}
+}
+
+func TestExpectedSchema(t *testing.T) {
+	expected, err := ExpectedSchema(&verifyModel{})
+	assert.NoError(t, err)
+	assert.Equal(t, "verify_models", expected.Name)
+	assert.Empty(t, Diff(expected, matchingTable()))
+}
+
+func TestDiff_ReportsDrift(t *testing.T) {
+	expected, err := ExpectedSchema(&verifyModel{})
+	assert.NoError(t, err)
+
+	actual := matchingTable()
+	actual.Columns["is_deleted"] = Column{Name: "is_deleted", Type: "boolean", Nullable: true}
+	actual.Columns["created_at"] = Column{Name: "created_at", Type: "timestamp with time zone"}
+	actual.Columns["legacy"] = Column{Name: "legacy", Type: "text", Nullable: true}
+	delete(actual.Columns, "note")
+	actual.Indexes = actual.Indexes[:1]
+
+	assert.Equal(t, []string{
+		"table verify_models: column created_at type: model timestamp without time zone, database timestamp with time zone",
+		"table verify_models: column is_deleted nullable: model false, database true",
+		"table verify_models: column note missing in database",
+		"table verify_models: column legacy missing in model",
+		"table verify_models: unique index (email) missing in database",
+	}, Diff(expected, actual))
+}
+
+func TestDiff_MissingTable(t *testing.T) {
+	expected, err := ExpectedSchema(&verifyModel{})
+	assert.NoError(t, err)
+
+	diffs := Diff(expected, TableSchema{Name: "verify_models", Columns: map[string]Column{}})
+	assert.Equal(t, []string{"table verify_models: missing in database"}, diffs)
+}
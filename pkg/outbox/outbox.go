@@ -0,0 +1,115 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrUnknownEvent is returned for an event id the outbox does not hold.
+var ErrUnknownEvent = errors.New("unknown outbox event")
+
+// horizon is the oldest transaction still running. The transactions below it
+// have ended, so no event of theirs can become visible any more.
+const horizon = "pg_snapshot_xmin(pg_current_snapshot())::text::bigint"
+
+// Event is a domain event stored in the outbox table by the transaction that
+// caused it, and published by the Relay once that transaction committed.
+type Event struct {
+	Id          uint64          `gorm:"primaryKey;type:bigserial;index:outbox_unpublished_idx,where:published_at IS NULL AND failed_at IS NULL;index:outbox_tx_idx,priority:2" json:"id"`
+	Type        string          `json:"type"`
+	AggregateId string          `json:"aggregateId"`
+	Payload     json.RawMessage `gorm:"type:jsonb;not null" json:"payload"`
+	CreatedAt   time.Time       `gorm:"type:timestamptz" json:"createdAt"`
+	PublishedAt *time.Time      `gorm:"type:timestamptz" json:"publishedAt,omitempty"`
+	Attempts    int             `gorm:"type:integer" json:"-"`
+	LastError   string          `json:"-"`
+	// FailedAt is when the relay gave up publishing the event.
+	FailedAt *time.Time `gorm:"type:timestamptz" json:"-"`
+	// TxId is the transaction that added the event, set by the database.
+	TxId uint64 `gorm:"column:tx_id;type:bigint;not null;index:outbox_tx_idx,priority:1;<-:false" json:"-"`
+}
+
+func (Event) TableName() string {
+	return "outbox"
+}
+
+// NewEvent builds an event of eventType about the aggregate with the given id,
+// with payload encoded as JSON.
+func NewEvent(eventType, aggregateId string, payload interface{}) (*Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &Event{Type: eventType, AggregateId: aggregateId, Payload: data}, nil
+}
+
+// Append adds event to the outbox with tx, which must be the transaction of
+// the change the event describes.
+func Append(tx *gorm.DB, event *Event) error {
+	return tx.Create(event).Error
+}
+
+// Position is the place of an event in the order readers follow the outbox
+// in: by transaction, then by id. Since ids are taken before the transactions
+// commit, and not in the order they commit, ids alone would let a reader skip
+// an event committed after a later one was read.
+type Position struct {
+	TxId uint64
+	Id   uint64
+}
+
+func (e Event) Position() Position {
+	return Position{TxId: e.TxId, Id: e.Id}
+}
+
+// Less reports whether p comes before q.
+func (p Position) Less(q Position) bool {
+	return p.TxId < q.TxId || (p.TxId == q.TxId && p.Id < q.Id)
+}
+
+// After returns up to limit events following position, in order. It only
+// returns the events of transactions older than every running one, so an
+// event committed later never comes before those returned already.
+func After(db *gorm.DB, position Position, limit int) ([]Event, error) {
+	var events []Event
+	err := db.Where("(tx_id, id) > (?, ?) AND tx_id < "+horizon, position.TxId, position.Id).
+		Order("tx_id, id").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+// PositionOf returns the position of the event id, or ErrUnknownEvent when
+// there is none.
+func PositionOf(db *gorm.DB, id uint64) (Position, error) {
+	var events []Event
+	err := db.Select("tx_id", "id").Where("id = ?", id).Limit(1).Find(&events).Error
+	if err != nil {
+		return Position{}, err
+	}
+	if len(events) == 0 {
+		return Position{}, ErrUnknownEvent
+	}
+	return events[0].Position(), nil
+}
+
+// Latest returns the position of the last event After can return now, or the
+// position before every event when there is none.
+func Latest(db *gorm.DB) (Position, error) {
+	var events []Event
+	err := db.Select("tx_id", "id").Where("tx_id < " + horizon).Order("tx_id DESC, id DESC").Limit(1).Find(&events).Error
+	if err != nil || len(events) == 0 {
+		return Position{}, err
+	}
+	return events[0].Position(), nil
+}
+
+// Publisher delivers events to their consumers. Delivery is at least once:
+// an event is published again when the relay could not record that it was
+// published, so consumers must ignore events whose id they already handled.
+// An event the relay parked is only delivered once it is requeued.
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
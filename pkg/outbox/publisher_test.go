@@ -0,0 +1,64 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInProcessPublisher_StopsAtFailingHandler(t *testing.T) {
+	publisher := NewInProcessPublisher()
+	var got []string
+	publisher.Subscribe(func(ctx context.Context, event Event) error {
+		got = append(got, "first")
+		return nil
+	})
+	publisher.Subscribe(func(ctx context.Context, event Event) error {
+		return errors.New("consumer down")
+	})
+	publisher.Subscribe(func(ctx context.Context, event Event) error {
+		got = append(got, "third")
+		return nil
+	})
+
+	err := publisher.Publish(context.Background(), Event{Id: 1})
+	assert.ErrorContains(t, err, "consumer down")
+	assert.Equal(t, []string{"first"}, got)
+}
+
+func TestFilePublisher_AppendsJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	publisher, err := NewFilePublisher(path)
+	require.NoError(t, err)
+
+	for id := uint64(1); id <= 2; id++ {
+		event, err := NewEvent("CustomerCreated", "7", map[string]uint64{"seq": id})
+		require.NoError(t, err)
+		event.Id = id
+		require.NoError(t, publisher.Publish(context.Background(), *event))
+	}
+	require.NoError(t, publisher.Close())
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		events = append(events, event)
+	}
+	require.Len(t, events, 2)
+	assert.Equal(t, uint64(1), events[0].Id)
+	assert.Equal(t, "CustomerCreated", events[1].Type)
+	assert.JSONEq(t, `{"seq":2}`, string(events[1].Payload))
+}
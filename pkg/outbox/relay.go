@@ -0,0 +1,148 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"test-go/pkg/config"
+	"test-go/pkg/logging"
+	"test-go/pkg/metrics"
+
+	"gorm.io/gorm"
+)
+
+// relayLockKey is the advisory lock that lets a single relay publish at a
+// time when several replicas run one, so events keep their order.
+const relayLockKey = 7_460_001
+
+// Relay publishes the events of the outbox table in id order. Events of one
+// customer are in the order of their changes, since the writes of a customer
+// are serialized by its row lock. An event failing every attempt is parked and
+// no longer published until Requeue, or the requeue-outbox command of
+// cmd/migrate.go, makes it publishable again.
+type Relay struct {
+	db          *gorm.DB
+	publisher   Publisher
+	interval    time.Duration
+	maxBackoff  time.Duration
+	batchSize   int
+	maxAttempts int
+}
+
+func NewRelay(db *gorm.DB, publisher Publisher, cfg config.OutboxConfig) *Relay {
+	return &Relay{
+		db:          db,
+		publisher:   publisher,
+		interval:    cfg.PollInterval,
+		maxBackoff:  cfg.MaxBackoff,
+		batchSize:   cfg.BatchSize,
+		maxAttempts: cfg.MaxAttempts,
+	}
+}
+
+// Run polls the outbox until ctx is canceled. After a failure it waits twice
+// as long as the previous time, up to the maximum backoff, before retrying.
+func (r *Relay) Run(ctx context.Context) {
+	logger := logging.FromContext(ctx).With("worker", "outbox-relay")
+	wait := r.interval
+
+	for {
+		published, err := r.PublishPending(ctx)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			wait = r.nextBackoff(wait)
+			logger.Warn("failed to publish outbox event", "error", err, "retry_in", wait.String())
+		case published == r.batchSize:
+			// more events are waiting
+			wait = 0
+		default:
+			wait = r.interval
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (r *Relay) nextBackoff(previous time.Duration) time.Duration {
+	if previous < r.interval {
+		previous = r.interval
+	}
+	return min(previous*2, r.maxBackoff)
+}
+
+// PublishPending publishes one batch of the oldest unpublished events and
+// returns how many were published. It stops at the first event that fails,
+// records the failure on it and returns the error, so later events never
+// overtake it. An event failing for the last allowed attempt is parked
+// instead, and the events after it are published.
+func (r *Relay) PublishPending(ctx context.Context) (int, error) {
+	published := 0
+	var publishErr error
+	var parked []Event
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var locked bool
+		if err := tx.Raw("SELECT pg_try_advisory_xact_lock(?)", relayLockKey).Scan(&locked).Error; err != nil || !locked {
+			return err
+		}
+
+		var events []Event
+		if err := tx.Where("published_at IS NULL AND failed_at IS NULL").Order("id").Limit(r.batchSize).Find(&events).Error; err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			if publishErr = r.publisher.Publish(ctx, event); publishErr != nil {
+				event.Attempts++
+				event.LastError = logging.Redact(publishErr.Error())
+				updates := map[string]interface{}{
+					"attempts":   gorm.Expr("attempts + 1"),
+					"last_error": event.LastError,
+				}
+				if event.Attempts < r.maxAttempts {
+					return tx.Model(&Event{}).Where("id = ?", event.Id).Updates(updates).Error
+				}
+
+				updates["failed_at"] = time.Now()
+				if err := tx.Model(&Event{}).Where("id = ?", event.Id).Updates(updates).Error; err != nil {
+					return err
+				}
+				parked = append(parked, event)
+				publishErr = nil
+				continue
+			}
+			if err := tx.Model(&Event{}).Where("id = ?", event.Id).Update("published_at", time.Now()).Error; err != nil {
+				return err
+			}
+			logging.FromContext(ctx).DebugContext(ctx, "published outbox event", "event_id", event.Id, "type", event.Type)
+			published++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, event := range parked {
+		metrics.OutboxEventsParked.Inc()
+		logging.FromContext(ctx).ErrorContext(ctx, "parked outbox event failing every attempt",
+			"event_id", event.Id, "type", event.Type, "attempts", event.Attempts, "error", event.LastError)
+	}
+	return published, publishErr
+}
+
+// Requeue makes the parked events ids, or every parked event when there are
+// no ids, publishable again with a fresh set of attempts. It returns how many
+// events it requeued.
+func Requeue(ctx context.Context, db *gorm.DB, ids ...uint64) (int64, error) {
+	query := db.WithContext(ctx).Model(&Event{}).Where("failed_at IS NOT NULL AND published_at IS NULL")
+	if len(ids) > 0 {
+		query = query.Where("id IN ?", ids)
+	}
+	result := query.Updates(map[string]interface{}{"failed_at": nil, "attempts": 0})
+	return result.RowsAffected, result.Error
+}
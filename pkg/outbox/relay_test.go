@@ -0,0 +1,132 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"test-go/internal/testdb"
+	"test-go/pkg/config"
+	"test-go/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// openTestDatabase returns the test database with an empty outbox.
+func openTestDatabase(t *testing.T) *gorm.DB {
+	return testdb.Open(t, "outbox")
+}
+
+type recordingPublisher struct {
+	published []uint64
+	failOn    uint64
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, event Event) error {
+	if event.Id == p.failOn {
+		return errors.New("broker unavailable")
+	}
+	p.published = append(p.published, event.Id)
+	return nil
+}
+
+func TestIntegration_RelayPublishesInOrderAndRetries(t *testing.T) {
+	db := openTestDatabase(t)
+	ctx := context.Background()
+	for range 3 {
+		event, err := NewEvent("CustomerUpdated", "1", map[string]string{})
+		require.NoError(t, err)
+		require.NoError(t, db.Create(event).Error)
+	}
+
+	publisher := &recordingPublisher{failOn: 2}
+	relay := NewRelay(db, publisher, config.OutboxConfig{PollInterval: time.Second, BatchSize: 10, MaxBackoff: time.Minute, MaxAttempts: 10})
+
+	published, err := relay.PublishPending(ctx)
+	assert.Error(t, err)
+	assert.Equal(t, 1, published)
+	assert.Equal(t, []uint64{1}, publisher.published, "events after the failing one must wait")
+
+	var failed Event
+	require.NoError(t, db.First(&failed, 2).Error)
+	assert.Nil(t, failed.PublishedAt)
+	assert.Equal(t, 1, failed.Attempts)
+	assert.Equal(t, "broker unavailable", failed.LastError)
+
+	publisher.failOn = 0
+	published, err = relay.PublishPending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, published)
+	assert.Equal(t, []uint64{1, 2, 3}, publisher.published)
+
+	var pending int64
+	require.NoError(t, db.Model(&Event{}).Where("published_at IS NULL").Count(&pending).Error)
+	assert.Zero(t, pending)
+}
+
+func TestIntegration_RelayParksEventsFailingEveryAttempt(t *testing.T) {
+	db := openTestDatabase(t)
+	ctx := context.Background()
+	for range 3 {
+		event, err := NewEvent("CustomerUpdated", "1", map[string]string{})
+		require.NoError(t, err)
+		require.NoError(t, db.Create(event).Error)
+	}
+
+	publisher := &recordingPublisher{failOn: 2}
+	relay := NewRelay(db, publisher, config.OutboxConfig{PollInterval: time.Second, BatchSize: 10, MaxBackoff: time.Minute, MaxAttempts: 2})
+	parked := testutil.ToFloat64(metrics.OutboxEventsParked)
+
+	_, err := relay.PublishPending(ctx)
+	assert.Error(t, err)
+	assert.Equal(t, []uint64{1}, publisher.published)
+
+	published, err := relay.PublishPending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+	assert.Equal(t, []uint64{1, 3}, publisher.published, "events after a parked one are published")
+	assert.Equal(t, parked+1, testutil.ToFloat64(metrics.OutboxEventsParked))
+
+	var failed Event
+	require.NoError(t, db.First(&failed, 2).Error)
+	assert.Nil(t, failed.PublishedAt)
+	assert.NotNil(t, failed.FailedAt)
+	assert.Equal(t, 2, failed.Attempts)
+
+	published, err = relay.PublishPending(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, published, "parked events are skipped")
+
+	requeued, err := Requeue(ctx, db, 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), requeued, "only parked events are requeued")
+	require.NoError(t, db.First(&failed, 2).Error)
+	assert.Nil(t, failed.FailedAt)
+	assert.Zero(t, failed.Attempts)
+
+	publisher.failOn = 0
+	published, err = relay.PublishPending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+	assert.Equal(t, []uint64{1, 3, 2}, publisher.published, "the requeued event is published")
+
+	requeued, err = Requeue(ctx, db)
+	require.NoError(t, err)
+	assert.Zero(t, requeued)
+}
+
+func TestRelay_BackoffDoublesUpToMaximum(t *testing.T) {
+	relay := NewRelay(nil, nil, config.OutboxConfig{PollInterval: time.Second, BatchSize: 10, MaxBackoff: 5 * time.Second})
+
+	var waits []time.Duration
+	wait := time.Duration(0)
+	for range 4 {
+		wait = relay.nextBackoff(wait)
+		waits = append(waits, wait)
+	}
+	assert.Equal(t, []time.Duration{2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}, waits)
+}
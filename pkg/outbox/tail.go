@@ -0,0 +1,165 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	database "test-go/pkg/db"
+	"test-go/pkg/logging"
+
+	"gorm.io/gorm"
+)
+
+// tailBatchSize bounds the events read by one poll of a Tail.
+const tailBatchSize = 500
+
+// Tail follows the outbox table and hands every new event to its
+// subscribers. Each replica runs its own, so subscribers see every event
+// whichever replica made the change or relays the events. It reads from the
+// primary: the horizon and the rows seen by a read replica lag behind it, so
+// the order of the events and the position of a just received one would not
+// hold there.
+type Tail struct {
+	db       *gorm.DB
+	interval time.Duration
+	buffer   int
+
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+	closed      bool
+}
+
+// Subscription receives the events followed by a Tail, in the order of their
+// positions.
+type Subscription struct {
+	tail   *Tail
+	events chan Event
+}
+
+// NewTail polls the outbox every interval. Subscribers that fall more than
+// buffer events behind are dropped.
+func NewTail(db *gorm.DB, interval time.Duration, buffer int) *Tail {
+	return &Tail{db: db, interval: interval, buffer: buffer, subscribers: map[*Subscription]struct{}{}}
+}
+
+// Run follows the events added from now on until ctx is canceled.
+func (t *Tail) Run(ctx context.Context) {
+	logger := logging.FromContext(ctx).With("worker", "outbox-tail")
+	db := t.db.WithContext(database.ReadPrimary(ctx))
+
+	var last Position
+	for {
+		var err error
+		if last, err = Latest(db); err == nil {
+			break
+		}
+		logger.Warn("failed to read the outbox position", "error", err)
+		if !t.sleep(ctx, t.interval) {
+			return
+		}
+	}
+
+	for {
+		events, err := After(db, last, tailBatchSize)
+		if err != nil && ctx.Err() == nil {
+			logger.Warn("failed to read outbox events", "error", err)
+		}
+		for _, event := range events {
+			t.broadcast(event)
+			last = event.Position()
+		}
+
+		wait := t.interval
+		if len(events) == tailBatchSize {
+			wait = 0
+		}
+		if !t.sleep(ctx, wait) {
+			return
+		}
+	}
+}
+
+func (t *Tail) sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+func (t *Tail) broadcast(event Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for sub := range t.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			// too slow: it must catch up from the table
+			delete(t.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// Subscribe starts receiving the events read from now on. The subscription's
+// channel is closed when the subscriber falls behind or the tail is closed;
+// the subscriber then reads the events it missed with After. It returns nil
+// once the tail is closed.
+func (t *Tail) Subscribe() *Subscription {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil
+	}
+	sub := &Subscription{tail: t, events: make(chan Event, t.buffer)}
+	t.subscribers[sub] = struct{}{}
+	return sub
+}
+
+// Close ends every subscription and refuses new ones, so long lived
+// subscribers such as event streams let the server shut down.
+func (t *Tail) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+	for sub := range t.subscribers {
+		delete(t.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// Since returns up to limit events following position, for subscribers
+// resuming from the last event they received.
+func (t *Tail) Since(ctx context.Context, position Position, limit int) ([]Event, error) {
+	return After(t.db.WithContext(database.ReadPrimary(ctx)), position, limit)
+}
+
+// PositionOf returns the position of the event id, for subscribers resuming
+// from an event id, or ErrUnknownEvent when there is none.
+func (t *Tail) PositionOf(ctx context.Context, id uint64) (Position, error) {
+	return PositionOf(t.db.WithContext(database.ReadPrimary(ctx)), id)
+}
+
+// Latest returns the position of the last event Since can return now.
+func (t *Tail) Latest(ctx context.Context) (Position, error) {
+	return Latest(t.db.WithContext(database.ReadPrimary(ctx)))
+}
+
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+func (s *Subscription) Close() {
+	s.tail.mu.Lock()
+	defer s.tail.mu.Unlock()
+
+	if _, ok := s.tail.subscribers[s]; ok {
+		delete(s.tail.subscribers, s)
+		close(s.events)
+	}
+}
@@ -0,0 +1,88 @@
+package outbox
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestTail_DropsSubscribersThatFallBehind(t *testing.T) {
+	tail := NewTail(nil, 0, 2)
+	slow := tail.Subscribe()
+	fast := tail.Subscribe()
+
+	for id := uint64(1); id <= 3; id++ {
+		tail.broadcast(Event{Id: id})
+		if id < 3 {
+			assert.Equal(t, id, (<-fast.Events()).Id)
+		}
+	}
+
+	var received []uint64
+	for event := range slow.Events() {
+		received = append(received, event.Id)
+	}
+	assert.Equal(t, []uint64{1, 2}, received, "the slow subscription is closed once its buffer is full")
+	assert.Equal(t, uint64(3), (<-fast.Events()).Id)
+	fast.Close()
+	fast.Close()
+}
+
+func TestTail_CloseEndsSubscriptions(t *testing.T) {
+	tail := NewTail(nil, 0, 1)
+	sub := tail.Subscribe()
+
+	tail.Close()
+	_, open := <-sub.Events()
+	assert.False(t, open)
+	assert.Nil(t, tail.Subscribe())
+	sub.Close()
+}
+
+func TestPosition_OrdersByTransactionThenId(t *testing.T) {
+	assert.True(t, Position{TxId: 1, Id: 5}.Less(Position{TxId: 2, Id: 3}), "an event of an earlier transaction comes first")
+	assert.True(t, Position{TxId: 2, Id: 3}.Less(Position{TxId: 2, Id: 4}))
+	assert.False(t, Position{TxId: 2, Id: 4}.Less(Position{TxId: 2, Id: 4}))
+	assert.False(t, Position{TxId: 3, Id: 1}.Less(Position{TxId: 2, Id: 9}))
+}
+
+func TestIntegration_AfterWaitsForTransactionsCommittingLate(t *testing.T) {
+	db := openTestDatabase(t)
+	event := func() *Event {
+		event, err := NewEvent("CustomerUpdated", "1", map[string]string{})
+		require.NoError(t, err)
+		return event
+	}
+
+	// The first transaction takes the first id but commits after the second.
+	late := db.Begin()
+	defer late.Rollback()
+	require.NoError(t, Append(late, event()))
+	require.NoError(t, db.Transaction(func(tx *gorm.DB) error { return Append(tx, event()) }))
+
+	events, err := After(db, Position{}, 10)
+	require.NoError(t, err)
+	assert.Empty(t, events, "the second event waits for the first transaction")
+
+	require.NoError(t, late.Commit().Error)
+	events, err = After(db, Position{}, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, uint64(1), events[0].Id)
+	assert.Equal(t, uint64(2), events[1].Id)
+
+	latest, err := Latest(db)
+	require.NoError(t, err)
+	assert.Equal(t, events[1].Position(), latest)
+	position, err := PositionOf(db, 1)
+	require.NoError(t, err)
+	assert.Equal(t, events[0].Position(), position)
+	_, err = PositionOf(db, 99)
+	assert.ErrorIs(t, err, ErrUnknownEvent)
+	events, err = After(db, position, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, uint64(2), events[0].Id)
+}
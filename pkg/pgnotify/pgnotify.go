@@ -0,0 +1,119 @@
+package pgnotify
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"test-go/pkg/logging"
+
+	"github.com/jackc/pgx/v5"
+	"gorm.io/gorm"
+)
+
+// Notify sends payload on channel with db. Inside a transaction, Postgres
+// only delivers the notification once the transaction commits, and not at
+// all when it rolls back.
+func Notify(db *gorm.DB, channel, payload string) error {
+	return db.Exec("SELECT pg_notify(?, ?)", channel, payload).Error
+}
+
+// Listener receives the notifications of one channel on a dedicated
+// connection and hands their payloads to its handlers. It reconnects when the
+// connection fails.
+type Listener struct {
+	dsn        string
+	channel    string
+	backoff    time.Duration
+	maxBackoff time.Duration
+
+	mu        sync.RWMutex
+	onNotify  []func(ctx context.Context, payload string)
+	onConnect []func(ctx context.Context)
+}
+
+// NewListener listens on channel of the database at dsn. After a failure it
+// waits backoff before reconnecting, doubled after every further failure up
+// to maxBackoff.
+func NewListener(dsn, channel string, backoff, maxBackoff time.Duration) *Listener {
+	return &Listener{dsn: dsn, channel: channel, backoff: backoff, maxBackoff: maxBackoff}
+}
+
+// OnNotify registers fn to receive the payload of every notification.
+func (l *Listener) OnNotify(fn func(ctx context.Context, payload string)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.onNotify = append(l.onNotify, fn)
+}
+
+// OnConnect registers fn to run every time the listener starts listening.
+// Notifications sent while it was disconnected are lost, so fn should drop
+// whatever they would have invalidated.
+func (l *Listener) OnConnect(fn func(ctx context.Context)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.onConnect = append(l.onConnect, fn)
+}
+
+// Run listens until ctx is canceled.
+func (l *Listener) Run(ctx context.Context) {
+	logger := logging.FromContext(ctx).With("worker", "listener", "channel", l.channel)
+
+	wait := l.backoff
+	for {
+		connected, err := l.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			wait = l.backoff
+		}
+		logger.Warn("lost the notification connection, reconnecting", "error", err, "retry_in", wait.String())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, l.maxBackoff)
+	}
+}
+
+// listen connects, listens and dispatches notifications until the
+// connection fails. It reports whether it got to listen.
+func (l *Listener) listen(ctx context.Context) (bool, error) {
+	config, err := pgx.ParseConfig(l.dsn)
+	if err != nil {
+		return false, err
+	}
+	// lets operators spot the listening connections in pg_stat_activity
+	config.RuntimeParams["application_name"] = "listener:" + l.channel
+
+	conn, err := pgx.ConnectConfig(ctx, config)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{l.channel}.Sanitize()); err != nil {
+		return false, err
+	}
+
+	l.mu.RLock()
+	for _, fn := range l.onConnect {
+		fn(ctx)
+	}
+	l.mu.RUnlock()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return true, err
+		}
+		l.mu.RLock()
+		for _, fn := range l.onNotify {
+			fn(ctx, notification.Payload)
+		}
+		l.mu.RUnlock()
+	}
+}
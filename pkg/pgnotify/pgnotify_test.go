@@ -0,0 +1,84 @@
+package pgnotify
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"test-go/internal/testdb"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+const testChannel = "pgnotify_test"
+
+// openTestDatabase returns the test database and its DSN.
+func openTestDatabase(t *testing.T) (*gorm.DB, string) {
+	dsn := testdb.DSN(t)
+	return testdb.Connect(t, dsn), dsn
+}
+
+// startListener runs a listener on testChannel and returns the channels of
+// its connections and payloads.
+func startListener(t *testing.T, dsn string) (<-chan struct{}, <-chan string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	connected := make(chan struct{}, 10)
+	payloads := make(chan string, 10)
+	listener := NewListener(dsn, testChannel, 10*time.Millisecond, 100*time.Millisecond)
+	listener.OnConnect(func(ctx context.Context) { connected <- struct{}{} })
+	listener.OnNotify(func(ctx context.Context, payload string) { payloads <- payload })
+	go listener.Run(ctx)
+	return connected, payloads
+}
+
+func receive[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+	select {
+	case value := <-ch:
+		return value
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting")
+		panic("unreachable")
+	}
+}
+
+func TestIntegration_NotifiesCommittedTransactionsOnly(t *testing.T) {
+	db, dsn := openTestDatabase(t)
+	connected, payloads := startListener(t, dsn)
+	receive(t, connected)
+
+	rollback := errors.New("rollback")
+	err := db.Transaction(func(tx *gorm.DB) error {
+		require.NoError(t, Notify(tx, testChannel, "rolled back"))
+		return rollback
+	})
+	require.ErrorIs(t, err, rollback)
+	require.NoError(t, db.Transaction(func(tx *gorm.DB) error {
+		return Notify(tx, testChannel, "committed")
+	}))
+
+	assert.Equal(t, "committed", receive(t, payloads))
+	select {
+	case payload := <-payloads:
+		t.Fatalf("unexpected notification %q", payload)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestIntegration_ReconnectsAfterConnectionLoss(t *testing.T) {
+	db, dsn := openTestDatabase(t)
+	connected, payloads := startListener(t, dsn)
+	receive(t, connected)
+
+	require.NoError(t, db.Exec(
+		"SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE application_name = ?", "listener:"+testChannel).Error)
+	receive(t, connected)
+
+	require.NoError(t, Notify(db, testChannel, "after reconnect"))
+	assert.Equal(t, "after reconnect", receive(t, payloads))
+}
@@ -0,0 +1,37 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroup_StopWaitsForWorkers(t *testing.T) {
+	g := NewGroup()
+	stopped := false
+	g.Go("test", func(ctx context.Context) {
+		<-ctx.Done()
+		stopped = true
+	})
+
+	err := g.Stop(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, stopped)
+}
+
+func TestGroup_StopGivesUpAfterDeadline(t *testing.T) {
+	g := NewGroup()
+	release := make(chan struct{})
+	defer close(release)
+	g.Go("stuck", func(ctx context.Context) {
+		<-release
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := g.Stop(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}